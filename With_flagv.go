@@ -2,22 +2,32 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
-	"sort"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v53/github"
 	"golang.org/x/oauth2"
 )
 
-// Codecov API base URL
-const codecovAPIBase = "https://codecov.io/api/v2/github"
+// Codecov API base URLs for commits and for reports; variables so tests can point them
+// at a fake server
+var (
+	codecovAPIBase       = "https://codecov.io/api/v2/github"
+	codecovReportAPIBase = "https://api.codecov.io/api/v2/gh"
+)
+
+// Page size requested from paginated Codecov endpoints
+const codecovPageSize = 100
 
 // Structs for detailed file coverage report
 type FileCoverage struct {
@@ -37,139 +47,241 @@ type CodecovReport struct {
 	Files []FileCoverage `json:"files"`
 }
 
-// RepoCoverage stores repo name and its coverage percentage
+// RepoCoverage stores repo name, its coverage percentage and how it was determined
 type RepoCoverage struct {
-	Name       string
-	Coverage   float64
-	Configured bool
+	Org      string
+	Name     string
+	Branch   string
+	Commit   string // commit the coverage was read for, when pinned to the branch HEAD
+	Coverage float64
+	// provider coverage before ignored files were excluded, nil if coverage was not recomputed
+	RawCoverage *float64
+	Status      CoverageStatus
+	Err         error // underlying error for error statuses
 }
 
-// Fetch all repositories using pagination
-func getAllRepos(org, githubToken string) ([]string, error) {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
-	tc := oauth2.NewClient(ctx, ts)
-	ghClient := github.NewClient(tc)
-
-	var allRepos []string
-	opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
-
-	for {
-		repos, resp, err := ghClient.Repositories.ListByOrg(ctx, org, opts)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching repositories from GitHub: %v", err)
-		}
+// FullName returns the "org/repo" name of the repo
+func (r RepoCoverage) FullName() string {
+	return r.Org + "/" + r.Name
+}
 
-		for _, repo := range repos {
-			allRepos = append(allRepos, repo.GetName())
-		}
+// Create a GitHub client that is rate limited and retries rate limit errors
+func newGitHubClient(githubToken string) *github.Client {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
+	tc := oauth2.NewClient(context.Background(), ts)
+	// retries are left to withGitHubRetry, which also handles go-github rate limit errors
+	tc.Transport = &rateLimitedTransport{limiter: githubLimiter, base: tc.Transport}
+	return github.NewClient(tc)
+}
 
-		if resp.NextPage == 0 {
-			break
-		}
+// codecovCommit is a commit as returned by the Codecov commits API
+type codecovCommit struct {
+	CommitID string `json:"commitid"`
+	// commits without an uploaded report have no totals
+	Totals *struct {
+		Coverage float64 `json:"coverage"`
+	} `json:"totals"`
+}
 
-		opts.Page = resp.NextPage
+// result builds the RepoCoverage of repo from the commit
+func (c codecovCommit) result(repo, sha string) RepoCoverage {
+	if c.Totals == nil {
+		return RepoCoverage{Name: repo, Commit: sha, Status: StatusNoUploads}
 	}
-
-	return allRepos, nil
+	result := coverageResult(repo, c.Totals.Coverage)
+	result.Commit = sha
+	return result
 }
 
-// Fetch latest commit test coverage for a repository
-func getRepoCoverage(org, repo, token string) (float64, bool) {
+// Fetch test coverage of a commit for a repository. With a sha, that commit is looked up
+// directly; without one, the latest commit listed for the branch is used.
+func getRepoCoverage(org, repo, branch, sha, token string) RepoCoverage {
 	url := fmt.Sprintf("%s/%s/repos/%s/commits", codecovAPIBase, org, repo)
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		return 0, false
+	if sha != "" {
+		var commit codecovCommit
+		err := getCodecov(url+"/"+neturl.PathEscape(sha), token, nil, &commit)
+		if err == nil {
+			return commit.result(repo, sha)
+		}
+		if statusForError(err) != StatusNotConfigured {
+			return errorResult(repo, err)
+		}
+		// Codecov has not seen the commit, so nothing was uploaded for it, if the repo
+		// itself is known
+		latest := getRepoCoverage(org, repo, branch, "", token)
+		if latest.Status.IsError() || latest.Status == StatusNotConfigured {
+			return latest
+		}
+		return RepoCoverage{Name: repo, Commit: sha, Status: StatusNoUploads}
 	}
-	defer resp.Body.Close()
 
+	query := neturl.Values{}
+	if branch != "" {
+		query.Set("branch", branch)
+	}
 	var data struct {
-		Results []struct {
-			Totals struct {
-				Coverage float64 `json:"coverage"`
-			} `json:"totals"`
-		} `json:"results"`
+		Results []codecovCommit `json:"results"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0, false
+	// the latest commit is listed first
+	if err := getCodecovPage(url, token, query, 1, &data); err != nil {
+		return errorResult(repo, err)
 	}
-
-	if len(data.Results) == 0 || data.Results[0].Totals.Coverage == 0 {
-		return 0, false
+	if len(data.Results) == 0 {
+		return RepoCoverage{Name: repo, Status: StatusNoUploads}
 	}
-
-	return data.Results[0].Totals.Coverage, true
+	return data.Results[0].result(repo, "")
 }
 
-// Fetch detailed code coverage report
-func getDetailedCoverageReport(org, repo, token string) (*CodecovReport, error) {
-	url := fmt.Sprintf("https://api.codecov.io/api/v2/gh/%s/repos/%s/report", org, repo)
+// Fetch detailed code coverage report of a commit, or of the branch HEAD known to Codecov
+// when sha is empty
+func getDetailedCoverageReport(org, repo, branch, sha, token string) (*CodecovReport, error) {
+	url := fmt.Sprintf("%s/%s/repos/%s/report", codecovReportAPIBase, org, repo)
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
+	query := neturl.Values{}
+	if sha != "" {
+		query.Set("sha", sha)
+	} else if branch != "" {
+		query.Set("branch", branch)
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to fetch detailed report for %s", repo)
+	report := &CodecovReport{}
+	for page := 1; ; page++ {
+		var data struct {
+			codecovPage
+			CodecovReport
+		}
+		if err := getCodecovPage(url, token, query, page, &data); err != nil {
+			return nil, fmt.Errorf("failed to fetch detailed report for %s: %w", repo, err)
+		}
+
+		// totals cover the whole report and are repeated on every page
+		report.Totals = data.Totals
+		report.Files = append(report.Files, data.Files...)
+
+		if !data.hasNext(page) {
+			break
+		}
 	}
-	defer resp.Body.Close()
 
-	var report CodecovReport
-	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
-		return nil, err
+	return report, nil
+}
+
+// codecovPage holds the pagination fields of Codecov API responses
+type codecovPage struct {
+	Next       *string `json:"next"`
+	TotalPages int     `json:"total_pages"`
+}
+
+// hasNext reports whether there is a page after page
+func (p codecovPage) hasNext(page int) bool {
+	if p.Next != nil {
+		return *p.Next != ""
 	}
+	return page < p.TotalPages
+}
 
-	return &report, nil
+// Fetch one page of a Codecov API endpoint and decode it into out
+func getCodecovPage(url, token string, query neturl.Values, page int, out interface{}) error {
+	pageQuery := neturl.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	pageQuery.Set("page", strconv.Itoa(page))
+	pageQuery.Set("page_size", strconv.Itoa(codecovPageSize))
+	return getCodecov(url, token, pageQuery, out)
 }
 
-// Generate a CSV file for detailed coverage
-func generateCSVReport(repo string, report *CodecovReport) error {
-	filename := fmt.Sprintf("detailed_%s_coverage_report.csv", repo)
-	file, err := os.Create(filename)
+// Fetch a Codecov API endpoint and decode the response into out
+func getCodecov(url, token string, query neturl.Values, out interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Printf("❌ Error writing report for %s: %v\n", repo, err)
 		return err
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write CSV headers
-	writer.Write([]string{"File", "Total Lines", "Covered Lines", "Missed Lines", "Coverage %"})
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.URL.RawQuery = query.Encode()
 
-	// Sort files by lowest coverage (ascending order)
-	sort.Slice(report.Files, func(i, j int) bool {
-		return report.Files[i].Totals.Coverage < report.Files[j].Totals.Coverage
-	})
+	resp, err := codecovHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-	// Write data
-	for _, file := range report.Files {
-		writer.Write([]string{
-			file.Name,
-			fmt.Sprintf("%d", file.Totals.Lines),
-			fmt.Sprintf("%d", file.Totals.Hits),
-			fmt.Sprintf("%d", file.Totals.Misses),
-			fmt.Sprintf("%.2f", file.Totals.Coverage),
-		})
+	if resp.StatusCode != 200 {
+		return &APIError{Service: "codecov", StatusCode: resp.StatusCode}
 	}
 
-	fmt.Printf("✅ Detailed coverage report generated for %s: %s\n", repo, filename)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding Codecov response: %v", err)
+	}
 	return nil
 }
 
+// Restrict a coverage API request to a branch, if one is given
+func setBranchQuery(req *http.Request, branch string) {
+	if branch == "" {
+		return
+	}
+	query := req.URL.Query()
+	query.Set("branch", branch)
+	req.URL.RawQuery = query.Encode()
+}
+
 func main() {
+	// Dispatch subcommands; without one, scan the org
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "trend":
+			os.Exit(runTrend(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "prs":
+			os.Exit(runPRs(os.Args[2:]))
+		case "onboard":
+			os.Exit(runOnboard(os.Args[2:]))
+		case "rollup":
+			os.Exit(runRollup(os.Args[2:]))
+		case "profile":
+			os.Exit(runProfile(os.Args[2:]))
+		case "risk":
+			os.Exit(runRisk(os.Args[2:]))
+		}
+	}
+
 	// Parse flags
 	verbose := flag.Bool("v", false, "Enable verbose mode to generate detailed coverage reports")
+	targetOpts := addTargetFlags(flag.CommandLine)
+	collect := addCollectFlags(flag.CommandLine)
+	format := flag.String("format", "text", "Report format: text, csv, json, markdown or html")
+	output := flag.String("output", "", "Write the summary report to this file instead of stdout; detailed reports go next to it")
+	policyFile := flag.String("policy", "", "YAML coverage policy to enforce; violations exit with status 4")
+	historyDir := flag.String("history-dir", defaultHistoryDir, "Directory to save a coverage snapshot of this run to (empty to disable)")
+	ignoreOpts := addIgnoreFlags(flag.CommandLine)
+	publishOpts := addPublishFlags(flag.CommandLine)
+	logOpts := addLogFlags(flag.CommandLine)
 	flag.Parse()
 
-	org := "openshift" // Organization name
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if err := publishOpts.validate(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	reporter, err := newReporter(*format)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var policy *Policy
+	if *policyFile != "" {
+		policy, err = loadPolicy(*policyFile)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
 
 	// Get API tokens from environment variables
 	githubToken := os.Getenv("GITHUB_TOKEN")
@@ -177,54 +289,106 @@ func main() {
 		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
 	}
 
-	codecovToken := os.Getenv("CODECOV_TOKEN")
-	if codecovToken == "" {
-		log.Fatal("❌ Please set the CODECOV_TOKEN environment variable")
+	// Select coverage providers, reading their tokens from the environment
+	providers, err := collect.providers()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
-	// Fetch all repositories
-	repos, err := getAllRepos(org, githubToken)
+	// Resolve the repositories to scan
+	ghClient := newGitHubClient(githubToken)
+	targets, err := targetOpts.resolve(context.Background(), ghClient)
 	if err != nil {
 		log.Fatalf("❌ Error getting repositories: %v", err)
 	}
+	orgs := strings.Join(orgNames(targets), ", ")
+
+	// Fetch coverage for all repositories in parallel
+	// File rules in the policy need the detailed reports
+	// Ignoring files means recomputing totals from the detailed reports too
+	ignoreGlobs := ignoreOpts.patterns()
+	detailed := *verbose || (policy != nil && policy.NeedsFiles()) || len(ignoreGlobs) > 0
+	results := collectCoverage(collect.headClient(ghClient), targets, providers, detailed, collect.concurrency)
+	adjustCoverage(results, ignoreGlobs)
+
+	// Persist a snapshot so later runs can show trends
+	if *historyDir != "" {
+		if _, err := saveSnapshot(*historyDir, time.Now(), results); err != nil {
+			slog.Error("Error saving coverage snapshot", "dir", *historyDir, "error", err)
+		}
+	}
 
-	// Store coverage details
-	var coveredRepos []RepoCoverage
-	var notConfiguredRepos []RepoCoverage
-
-	// Fetch coverage for each repository
-	for _, repo := range repos {
-		coverage, configured := getRepoCoverage(org, repo, codecovToken)
-		if configured {
-			coveredRepos = append(coveredRepos, RepoCoverage{Name: repo, Coverage: coverage, Configured: true})
+	// Split repositories with coverage from the rest
+	var coveredRepos []repoResult
+	var notConfiguredRepos []repoResult
+	exitCode := exitOK
+	for _, result := range results {
+		if result.Coverage.Status.HasCoverage() {
+			coveredRepos = append(coveredRepos, result)
 		} else {
-			notConfiguredRepos = append(notConfiguredRepos, RepoCoverage{Name: repo, Coverage: 0, Configured: false})
+			notConfiguredRepos = append(notConfiguredRepos, result)
+		}
+
+		if result.Coverage.Status.IsError() {
+			slog.Error("Error getting coverage", "repo", result.Coverage.FullName(), "status", result.Coverage.Status, "error", result.Coverage.Err)
+			exitCode = exitAPIErrors
 		}
 	}
 
 	// Sort repositories by coverage percentage (ascending order)
-	sort.Slice(coveredRepos, func(i, j int) bool {
-		return coveredRepos[i].Coverage < coveredRepos[j].Coverage
-	})
+	sortByCoverage(coveredRepos)
 
-	// Print CSV headers
-	fmt.Println("Repository, Coverage Percentage")
+	// List repositories with coverage first, followed by those without
+	var summary []RepoCoverage
+	for _, repo := range append(coveredRepos, notConfiguredRepos...) {
+		summary = append(summary, repo.Coverage)
+	}
+
+	out := os.Stdout
+	reportDir := "."
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+		reportDir = filepath.Dir(*output)
+	}
 
-	// Print repositories with coverage first (sorted in ascending order)
+	if err := reporter.Summary(out, orgs, summary); err != nil {
+		log.Fatalf("❌ Error writing report: %v", err)
+	}
+
+	// Generate detailed reports if verbose mode is enabled
 	for _, repo := range coveredRepos {
-		fmt.Printf("%s, %.2f%%\n", repo.Name, repo.Coverage)
+		if !*verbose || repo.Report == nil {
+			continue
+		}
+		filename, err := generateDetailedReport(reporter, reportDir, repo.Coverage, repo.Report)
+		if err != nil {
+			slog.Error("Error writing detailed report", "repo", repo.Coverage.FullName(), "error", err)
+			continue
+		}
+		slog.Info("Detailed coverage report generated", "repo", repo.Coverage.FullName(), "file", filename)
+	}
 
-		// Generate detailed CSV report if verbose mode is enabled
-		if *verbose {
-			report, err := getDetailedCoverageReport(org, repo.Name, codecovToken)
-			if err == nil {
-				_ = generateCSVReport(repo.Name, report)
-			}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing report: %v", err)
 		}
 	}
 
-	// Print repositories without coverage
-	for _, repo := range notConfiguredRepos {
-		fmt.Printf("%s, Not Configured\n", repo.Name)
+	// Post results back to GitHub; dry-run calls go to stderr to keep the report clean
+	if failures := publishOpts.publish(context.Background(), ghClient, os.Stderr, results); failures > 0 && exitCode == exitOK {
+		exitCode = exitAPIErrors
 	}
+
+	// Enforce the coverage policy
+	if policy != nil {
+		if violations := policy.Evaluate(results); len(violations) > 0 {
+			writeViolations(os.Stderr, violations)
+			exitCode = exitViolations
+		}
+	}
+
+	os.Exit(exitCode)
 }
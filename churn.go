@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// fileRisk is the coverage and recent churn of one file
+type fileRisk struct {
+	Org      string
+	Repo     string
+	File     string
+	Lines    int
+	Misses   int
+	Coverage float64
+	Commits  int // commits touching the file within the window
+}
+
+// FullName returns the "org/repo/path" name of the file
+func (f fileRisk) FullName() string {
+	return f.Org + "/" + f.Repo + "/" + f.File
+}
+
+// Score weighs the untested lines of a file by how often it changes. A file nobody has
+// touched within the window scores 0, however little of it is tested, and is ranked by
+// its untested lines after the files that changed.
+func (f fileRisk) Score() float64 {
+	return float64(f.Misses) * float64(f.Commits)
+}
+
+// runRisk implements the "risk" command, ranking the files of an org by missed lines
+// weighted by how often they changed recently
+func runRisk(args []string) int {
+	fs := flag.NewFlagSet("risk", flag.ExitOnError)
+	targetOpts := addTargetFlags(fs)
+	collect := addCollectFlags(fs)
+	ignoreOpts := addIgnoreFlags(fs)
+	window := fs.Duration("window", 90*24*time.Hour, "Count commits made within this duration before now")
+	checkouts := fs.String("checkouts", "", "Directory of local git checkouts (<dir>/<org>/<repo> or <dir>/<repo>) to count commits in instead of using the GitHub API")
+	maxCommits := fs.Int("max-commits", 300, "Maximum commits per repo to fetch changed files for from the GitHub API, each costing one request (0 for no limit)")
+	top := fs.Int("top", 50, "Only list the riskiest files (0 for all)")
+	format := fs.String("format", "text", "Output format: text, csv or json")
+	output := fs.String("output", "", "Write the ranking to this file instead of stdout")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		log.Fatalf("❌ unknown risk format %q (want text, csv or json)", *format)
+	}
+	if *window <= 0 {
+		log.Fatal("❌ -window must be positive")
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+	providers, err := collect.providers()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	ctx := context.Background()
+	ghClient := newGitHubClient(githubToken)
+	targets, err := targetOpts.resolve(ctx, ghClient)
+	if err != nil {
+		log.Fatalf("❌ Error getting repositories: %v", err)
+	}
+
+	// per-file misses come from the detailed reports
+	results := collectCoverage(collect.headClient(ghClient), targets, providers, true, collect.concurrency)
+	since := time.Now().Add(-*window)
+	churn := make([]map[string]int, len(targets))
+	churnErrors := make([]error, len(targets))
+	parallel(len(targets), collect.concurrency, func(i int) {
+		if results[i].Report == nil {
+			return
+		}
+		if dir := checkoutDir(*checkouts, targets[i]); dir != "" {
+			churn[i], churnErrors[i] = gitFileChurn(dir, targets[i].Branch, since)
+			return
+		}
+		churn[i], churnErrors[i] = githubFileChurn(ctx, ghClient, targets[i], since, *maxCommits)
+	})
+
+	exitCode := exitOK
+	ignore := ignoreOpts.patterns()
+	var risks []fileRisk
+	for i, result := range results {
+		repo := result.Coverage
+		if repo.Status.IsError() {
+			slog.Error("Error getting coverage", "repo", repo.FullName(), "status", repo.Status, "error", repo.Err)
+			exitCode = exitAPIErrors
+			continue
+		}
+		if result.Report == nil {
+			continue
+		}
+		if churnErrors[i] != nil {
+			slog.Error("Error counting commits", "repo", repo.FullName(), "error", churnErrors[i])
+			exitCode = exitAPIErrors
+			continue
+		}
+		for _, file := range result.Report.Files {
+			if ignored(file.Name, ignore) {
+				continue
+			}
+			risks = append(risks, fileRisk{
+				Org:      repo.Org,
+				Repo:     repo.Name,
+				File:     file.Name,
+				Lines:    file.Totals.Lines,
+				Misses:   file.Totals.Misses,
+				Coverage: file.Totals.Coverage,
+				Commits:  churn[i][file.Name],
+			})
+		}
+	}
+	rankRisks(risks)
+	if *top > 0 && len(risks) > *top {
+		risks = risks[:*top]
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+	}
+
+	switch *format {
+	case "csv":
+		err = writeRisksCSV(out, risks)
+	case "json":
+		err = writeRisksJSON(out, risks, *window)
+	default:
+		err = writeRisksText(out, risks, *window)
+	}
+	if err != nil {
+		log.Fatalf("❌ Error writing ranking: %v", err)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing ranking: %v", err)
+		}
+	}
+	return exitCode
+}
+
+// checkoutDir returns the local checkout of target under dir, or an empty string if
+// there is none
+func checkoutDir(dir string, target repoTarget) string {
+	if dir == "" {
+		return ""
+	}
+	for _, candidate := range []string{filepath.Join(dir, target.Org, target.Name), filepath.Join(dir, target.Name)} {
+		if _, err := os.Stat(filepath.Join(candidate, ".git")); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// gitFileChurn counts the commits since the given time touching each file of a branch of
+// a local repository, which need not be checked out; an empty branch means HEAD. Merge
+// commits are skipped so merged changes are only counted once.
+func gitFileChurn(dir, branch string, since time.Time) (map[string]int, error) {
+	ref, err := gitBranchRef(dir, branch)
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(dir, "log", "--no-merges", "--no-renames", "--name-only", "--format=", "--since="+since.Format(time.RFC3339), ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	churn := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if file := strings.TrimSpace(scanner.Text()); file != "" {
+			churn[file]++
+		}
+	}
+	return churn, scanner.Err()
+}
+
+// gitBranchRef returns the ref of branch in a local repository: the local branch, or the
+// origin remote's one for clones that never checked it out
+func gitBranchRef(dir, branch string) (string, error) {
+	if branch == "" {
+		return "HEAD", nil
+	}
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		if _, err := git(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch, dir)
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s in %s: %v: %s", args[0], dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// githubFileChurn counts the commits since the given time touching each file of the
+// target branch, using the GitHub commits API. Listing commits doesn't return their
+// files, so this costs one request per commit, up to maxCommits (0 for no limit); with
+// the default -github-rps, 300 commits take about 4 minutes per repo. Local checkouts
+// avoid that cost.
+func githubFileChurn(ctx context.Context, ghClient *github.Client, target repoTarget, since time.Time, maxCommits int) (map[string]int, error) {
+	var shas []string
+	opts := &github.CommitsListOptions{SHA: target.Branch, Since: since, ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var commits []*github.RepositoryCommit
+		var resp *github.Response
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var err error
+			commits, resp, err = ghClient.Repositories.ListCommits(ctx, target.Org, target.Name, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, commit := range commits {
+			// merged changes are counted on the commits that made them
+			if len(commit.Parents) > 1 {
+				continue
+			}
+			shas = append(shas, commit.GetSHA())
+		}
+
+		if resp.NextPage == 0 || (maxCommits > 0 && len(shas) >= maxCommits) {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if maxCommits > 0 && len(shas) > maxCommits {
+		slog.Warn("Only counting the latest commits", "repo", target.FullName(), "commits", maxCommits)
+		shas = shas[:maxCommits]
+	}
+	slog.Info("Fetching the files of each commit", "repo", target.FullName(), "commits", len(shas))
+
+	churn := map[string]int{}
+	for _, sha := range shas {
+		var commit *github.RepositoryCommit
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			commit, resp, err = ghClient.Repositories.GetCommit(ctx, target.Org, target.Name, sha, nil)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range commit.Files {
+			churn[file.GetFilename()]++
+		}
+	}
+	return churn, nil
+}
+
+// rankRisks sorts files by risk score (highest first), then by missed lines and name
+func rankRisks(risks []fileRisk) {
+	sort.Slice(risks, func(i, j int) bool {
+		a, b := risks[i], risks[j]
+		if a.Score() != b.Score() {
+			return a.Score() > b.Score()
+		}
+		if a.Misses != b.Misses {
+			return a.Misses > b.Misses
+		}
+		return a.FullName() < b.FullName()
+	})
+}
+
+func writeRisksText(w io.Writer, risks []fileRisk, window time.Duration) error {
+	fmt.Fprintf(w, "Riskiest untested files, by missed lines x commits in the last %s\n", window)
+	fmt.Fprintln(w, "Rank, File, Risk, Coverage, Missed Lines, Commits")
+	for i, risk := range risks {
+		fmt.Fprintf(w, "%d, %s, %.0f, %.2f%%, %d, %d\n", i+1, risk.FullName(), risk.Score(), risk.Coverage, risk.Misses, risk.Commits)
+	}
+	return nil
+}
+
+func writeRisksCSV(w io.Writer, risks []fileRisk) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Rank", "Organization", "Repository", "File", "Risk", "Coverage %", "Total Lines", "Missed Lines", "Commits"})
+	for i, risk := range risks {
+		writer.Write([]string{
+			fmt.Sprintf("%d", i+1),
+			risk.Org,
+			risk.Repo,
+			risk.File,
+			fmt.Sprintf("%.0f", risk.Score()),
+			fmt.Sprintf("%.2f", risk.Coverage),
+			fmt.Sprintf("%d", risk.Lines),
+			fmt.Sprintf("%d", risk.Misses),
+			fmt.Sprintf("%d", risk.Commits),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeRisksJSON(w io.Writer, risks []fileRisk, window time.Duration) error {
+	type jsonRisk struct {
+		Rank     int     `json:"rank"`
+		Org      string  `json:"org"`
+		Repo     string  `json:"repo"`
+		File     string  `json:"file"`
+		Risk     float64 `json:"risk"`
+		Coverage float64 `json:"coverage"`
+		Lines    int     `json:"lines"`
+		Misses   int     `json:"misses"`
+		Commits  int     `json:"commits"`
+	}
+
+	entries := make([]jsonRisk, 0, len(risks))
+	for i, risk := range risks {
+		entries = append(entries, jsonRisk{Rank: i + 1, Org: risk.Org, Repo: risk.Repo, File: risk.File, Risk: risk.Score(),
+			Coverage: risk.Coverage, Lines: risk.Lines, Misses: risk.Misses, Commits: risk.Commits})
+	}
+	return writeJSON(w, struct {
+		Window string     `json:"window"`
+		Files  []jsonRisk `json:"files"`
+	}{window.String(), entries})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// commitFile writes content to file in the git repository dir and commits it
+func commitFile(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", file}, {"commit", "-q", "-m", "change " + file}} {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+}
+
+func TestGitFileChurn(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	commitFile(t, dir, "a.go", "1")
+	commitFile(t, dir, "a.go", "2")
+	commitFile(t, dir, "b.go", "1")
+	// commits on a checked out feature branch must not count for main
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-q", "-b", "feature").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout: %v: %s", err, out)
+	}
+	commitFile(t, dir, "a.go", "3")
+	commitFile(t, dir, "c.go", "1")
+
+	since := time.Now().Add(-time.Hour)
+	tests := []struct {
+		branch  string
+		want    map[string]int
+		wantErr bool
+	}{
+		{branch: "main", want: map[string]int{"a.go": 2, "b.go": 1}},
+		{branch: "feature", want: map[string]int{"a.go": 3, "b.go": 1, "c.go": 1}},
+		{branch: "", want: map[string]int{"a.go": 3, "b.go": 1, "c.go": 1}},
+		{branch: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			got, err := gitFileChurn(dir, tt.branch, since)
+			if (err != nil) != tt.wantErr || (!tt.wantErr && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("gitFileChurn(%q) = %v, %v, want %v (error %v)", tt.branch, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if got, err := gitFileChurn(dir, "main", time.Now().Add(time.Hour)); err != nil || len(got) != 0 {
+		t.Errorf("gitFileChurn() of a future window = %v, %v, want no files", got, err)
+	}
+}
+
+func TestRankRisks(t *testing.T) {
+	risks := []fileRisk{
+		{Repo: "r", File: "stable.go", Misses: 50},
+		{Repo: "r", File: "busy.go", Misses: 5, Commits: 4},
+		{Repo: "r", File: "hot.go", Misses: 10, Commits: 3},
+		{Repo: "r", File: "covered.go", Commits: 9},
+		{Repo: "r", File: "also-stable.go", Misses: 50},
+	}
+	rankRisks(risks)
+
+	var got []string
+	for _, risk := range risks {
+		got = append(got, risk.File)
+	}
+	want := []string{"hot.go", "busy.go", "also-stable.go", "stable.go", "covered.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankRisks() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// collectOptions are the flags shared by every command that collects org coverage
+type collectOptions struct {
+	provider      string
+	orgProviders  string
+	repoProviders string
+	concurrency   int
+	githubRPS     float64
+	codecovRPS    float64
+	providerRPS   float64
+	pinHead       bool
+}
+
+// addCollectFlags registers the coverage collection flags on fs
+func addCollectFlags(fs *flag.FlagSet) *collectOptions {
+	opts := &collectOptions{}
+	fs.StringVar(&opts.provider, "provider", "codecov", "Coverage provider for the org (codecov, coveralls, sonarqube, coverprofile)")
+	fs.StringVar(&opts.orgProviders, "org-providers", "", "Per-org provider overrides, e.g. org1=coveralls,org2=sonarqube")
+	fs.StringVar(&opts.repoProviders, "repo-providers", "", "Per-repo provider overrides, e.g. repo1=coveralls,repo2=sonarqube")
+	fs.IntVar(&opts.concurrency, "concurrency", 8, "Number of repositories to fetch coverage for in parallel")
+	fs.Float64Var(&opts.githubRPS, "github-rps", 1.3, "Maximum GitHub API requests per second (0 for unlimited)")
+	fs.Float64Var(&opts.codecovRPS, "codecov-rps", 5, "Maximum Codecov API requests per second (0 for unlimited)")
+	fs.Float64Var(&opts.providerRPS, "provider-rps", 5, "Maximum Coveralls and SonarQube API requests per second (0 for unlimited)")
+	fs.IntVar(&maxRetries, "max-retries", maxRetries, "Maximum retries for rate limited or failed API requests")
+	fs.BoolVar(&opts.pinHead, "pin-head", true, "Read coverage for the branch HEAD commit on GitHub (one extra GitHub request per repo)")
+	return opts
+}
+
+// providers applies the rate limits and selects coverage providers, reading their
+// tokens from the environment
+func (o *collectOptions) providers() (*ProviderSelector, error) {
+	setRateLimit(githubLimiter, o.githubRPS)
+	setRateLimit(codecovLimiter, o.codecovRPS)
+	setRateLimit(providerLimiter, o.providerRPS)
+	return newProviderSelector(o.provider, o.orgProviders, o.repoProviders)
+}
+
+// headClient returns the GitHub client used to look up branch HEADs, or nil when
+// coverage should not be pinned to them
+func (o *collectOptions) headClient(ghClient *github.Client) *github.Client {
+	if !o.pinHead {
+		return nil
+	}
+	return ghClient
+}
+
+// repoResult is the coverage collected for one repository
+type repoResult struct {
+	Coverage RepoCoverage
+	Report   *CodecovReport // only set in verbose mode for covered repos
+}
+
+// collectCoverage fetches coverage for targets using a bounded pool of workers. With a
+// GitHub client, coverage is pinned to the HEAD commit of each target branch.
+// Results keep the order of targets; callers sort them once all workers are done.
+func collectCoverage(ghClient *github.Client, targets []repoTarget, providers *ProviderSelector, detailed bool, concurrency int) []repoResult {
+	results := make([]repoResult, len(targets))
+	parallel(len(targets), concurrency, func(i int) {
+		sha := ""
+		if ghClient != nil {
+			sha = headSHA(context.Background(), ghClient, targets[i])
+		}
+		results[i] = fetchRepoResult(targets[i], providers.For(targets[i]), sha, detailed)
+	})
+	return results
+}
+
+// parallel calls fn for each index in [0, n) using a bounded pool of workers and
+// returns once all calls are done
+func parallel(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// headSHA returns the HEAD commit of the target branch, or an empty string if it can't be
+// looked up, in which case the provider falls back to its latest commit for the branch
+func headSHA(ctx context.Context, ghClient *github.Client, target repoTarget) string {
+	var sha string
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		sha, resp, err = ghClient.Repositories.GetCommitSHA1(ctx, target.Org, target.Name, target.Branch, "")
+		return resp, err
+	})
+	if err != nil {
+		slog.Warn("Error getting branch HEAD, using the latest commit known to the provider", "repo", target.FullName(), "branch", target.Branch, "error", err)
+		return ""
+	}
+	return sha
+}
+
+// fetchRepoResult fetches coverage and, if requested, the detailed report for a single repo
+func fetchRepoResult(target repoTarget, provider CoverageProvider, sha string, detailed bool) repoResult {
+	result := repoResult{Coverage: provider.RepoCoverage(target.Org, target.Name, target.Branch, sha)}
+	result.Coverage.Org = target.Org
+	result.Coverage.Branch = target.Branch
+
+	if detailed && result.Coverage.Status.HasCoverage() {
+		report, err := provider.DetailedReport(target.Org, target.Name, target.Branch, sha)
+		if err == nil {
+			result.Report = report
+		}
+	}
+
+	return result
+}
+
+// sortByCoverage sorts results by coverage percentage (ascending order), then by name
+func sortByCoverage(results []repoResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Coverage.Coverage != results[j].Coverage.Coverage {
+			return results[i].Coverage.Coverage < results[j].Coverage.Coverage
+		}
+		return results[i].Coverage.FullName() < results[j].Coverage.FullName()
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3, 8, 100} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			const n = 40
+			var inFlight, maxInFlight int32
+			calls := make([]int32, n)
+			parallel(n, concurrency, func(i int) {
+				current := atomic.AddInt32(&inFlight, 1)
+				for {
+					seen := atomic.LoadInt32(&maxInFlight)
+					if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&calls[i], 1)
+				atomic.AddInt32(&inFlight, -1)
+			})
+
+			limit := int32(concurrency)
+			if limit < 1 {
+				limit = 1
+			}
+			if maxInFlight > limit {
+				t.Errorf("%d calls in flight, want at most %d", maxInFlight, limit)
+			}
+			for i, count := range calls {
+				if count != 1 {
+					t.Errorf("fn(%d) called %d times, want once", i, count)
+				}
+			}
+		})
+	}
+}
+
+// stubProvider returns coverage derived from the repo name, finishing later repos first
+type stubProvider struct {
+	mu       sync.Mutex
+	detailed []string
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) RepoCoverage(org, repo, branch, sha string) RepoCoverage {
+	var index int
+	fmt.Sscanf(repo, "repo%d", &index)
+	time.Sleep(time.Duration(10-index) * time.Millisecond)
+	if index%3 == 0 {
+		return RepoCoverage{Name: repo, Status: StatusNotConfigured}
+	}
+	return RepoCoverage{Name: repo, Coverage: float64(index * 10), Status: StatusCovered}
+}
+
+func (p *stubProvider) DetailedReport(org, repo, branch, sha string) (*CodecovReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.detailed = append(p.detailed, repo)
+	return &CodecovReport{Files: []FileCoverage{{Name: repo + ".go"}}}, nil
+}
+
+func TestCollectCoverageKeepsTargetOrder(t *testing.T) {
+	provider := &stubProvider{}
+	var targets []repoTarget
+	for i := 0; i < 10; i++ {
+		targets = append(targets, repoTarget{Org: "acme", Name: fmt.Sprintf("repo%d", i), Branch: "main"})
+	}
+
+	results := collectCoverage(nil, targets, &ProviderSelector{Default: provider}, true, 4)
+	if len(results) != len(targets) {
+		t.Fatalf("got %d results, want %d", len(results), len(targets))
+	}
+	for i, result := range results {
+		repo := result.Coverage
+		if repo.FullName() != targets[i].FullName() || repo.Branch != "main" {
+			t.Errorf("result %d is %s@%s, want %s@main", i, repo.FullName(), repo.Branch, targets[i].FullName())
+		}
+		wantReport := i%3 != 0
+		if (result.Report != nil) != wantReport {
+			t.Errorf("result %d has report %v, want %v", i, result.Report != nil, wantReport)
+		}
+	}
+	if len(provider.detailed) != 6 {
+		t.Errorf("detailed reports fetched for %v, want the 6 covered repos", provider.detailed)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// Kinds of per-file coverage change between two reports
+const (
+	changeRegressed = "regressed"
+	changeRemoved   = "removed"
+	changeAdded     = "added"
+	changeImproved  = "improved"
+	changeUnchanged = "unchanged"
+)
+
+// Order of change kinds in compare output, most interesting first
+var changeOrder = map[string]int{changeRegressed: 0, changeRemoved: 1, changeAdded: 2, changeImproved: 3, changeUnchanged: 4}
+
+// fileDelta is the coverage change of one file between a base and a head report
+type fileDelta struct {
+	Name   string
+	Change string
+	Base   *FileCoverage // nil for added files
+	Head   *FileCoverage // nil for removed files
+}
+
+// Delta returns the change in coverage points, and false for added or removed files
+func (d fileDelta) Delta() (float64, bool) {
+	if d.Base == nil || d.Head == nil {
+		return 0, false
+	}
+	return d.Head.Totals.Coverage - d.Base.Totals.Coverage, true
+}
+
+// coverageComparison is the comparison of a repo's coverage at two commits
+type coverageComparison struct {
+	Repo    string
+	BaseRef string
+	BaseSHA string
+	HeadRef string
+	HeadSHA string
+	Base    *CodecovReport
+	Head    *CodecovReport
+	Files   []fileDelta
+}
+
+// runCompare implements the "compare" command, printing per-file coverage deltas of a
+// repo between two refs. It returns the process exit code.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	repoFlag := fs.String("repo", "", "Repository to compare, as org/repo")
+	baseRef := fs.String("base", "", "Base SHA, branch, tag or date (YYYY-MM-DD or RFC 3339, meaning the default branch at that time, unless a branch or tag has that name)")
+	headRef := fs.String("head", "", "Head SHA, branch, tag or date (default: the default branch)")
+	format := fs.String("format", "text", "Output format: text, csv or json")
+	output := fs.String("output", "", "Write the comparison to this file instead of stdout")
+	unchanged := fs.Bool("unchanged", false, "Also list files whose coverage did not change")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if *repoFlag == "" || *baseRef == "" {
+		log.Fatal("❌ Please set -repo and -base")
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		log.Fatalf("❌ unknown compare format %q (want text, csv or json)", *format)
+	}
+
+	org, repo, ok := strings.Cut(*repoFlag, "/")
+	if !ok {
+		org, repo = defaultOrg, *repoFlag
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+	codecovToken := os.Getenv("CODECOV_TOKEN")
+	if codecovToken == "" {
+		log.Fatal("❌ Please set the CODECOV_TOKEN environment variable")
+	}
+
+	ctx := context.Background()
+	ghClient := newGitHubClient(githubToken)
+
+	comparison := &coverageComparison{Repo: org + "/" + repo, BaseRef: *baseRef, HeadRef: *headRef}
+	if comparison.HeadRef == "" {
+		comparison.HeadRef = "HEAD"
+	}
+
+	var err error
+	if comparison.BaseSHA, err = resolveRef(ctx, ghClient, org, repo, comparison.BaseRef); err != nil {
+		log.Fatalf("❌ Error resolving %s: %v", comparison.BaseRef, err)
+	}
+	if comparison.HeadSHA, err = resolveRef(ctx, ghClient, org, repo, comparison.HeadRef); err != nil {
+		log.Fatalf("❌ Error resolving %s: %v", comparison.HeadRef, err)
+	}
+
+	if comparison.Base, err = getDetailedCoverageReport(org, repo, "", comparison.BaseSHA, codecovToken); err != nil {
+		log.Fatalf("❌ Error getting coverage of %s: %v", comparison.BaseRef, err)
+	}
+	if comparison.Head, err = getDetailedCoverageReport(org, repo, "", comparison.HeadSHA, codecovToken); err != nil {
+		log.Fatalf("❌ Error getting coverage of %s: %v", comparison.HeadRef, err)
+	}
+
+	comparison.Files = compareReports(comparison.Base, comparison.Head)
+	if !*unchanged {
+		var changed []fileDelta
+		for _, delta := range comparison.Files {
+			if delta.Change != changeUnchanged {
+				changed = append(changed, delta)
+			}
+		}
+		comparison.Files = changed
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+	}
+
+	switch *format {
+	case "csv":
+		err = writeComparisonCSV(out, comparison)
+	case "json":
+		err = writeComparisonJSON(out, comparison)
+	default:
+		err = writeComparisonText(out, comparison)
+	}
+	if err != nil {
+		log.Fatalf("❌ Error writing comparison: %v", err)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing comparison: %v", err)
+		}
+	}
+	return exitOK
+}
+
+// resolveRef returns the commit SHA of a ref. "HEAD" is the default branch, and a date
+// that no branch or tag is named after is the last commit on the default branch at or
+// before it.
+func resolveRef(ctx context.Context, ghClient *github.Client, org, repo, ref string) (string, error) {
+	var sha string
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		sha, resp, err = ghClient.Repositories.GetCommitSHA1(ctx, org, repo, ref, "")
+		return resp, err
+	})
+	if err == nil {
+		return sha, nil
+	}
+
+	// GitHub answers 422 for refs that aren't a branch, tag or commit
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || (errResp.Response.StatusCode != http.StatusUnprocessableEntity && errResp.Response.StatusCode != http.StatusNotFound) {
+		return "", err
+	}
+	at, dateErr := parseBaselineTime(ref)
+	if dateErr != nil {
+		return "", err
+	}
+
+	var commits []*github.RepositoryCommit
+	err = withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		commits, resp, err = ghClient.Repositories.ListCommits(ctx, org, repo, &github.CommitsListOptions{
+			Until:       at.Add(-time.Nanosecond).Truncate(time.Second), // until is inclusive, to the second
+			ListOptions: github.ListOptions{PerPage: 1},
+		})
+		return resp, err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commit on the default branch at or before %s", ref)
+	}
+	return commits[0].GetSHA(), nil
+}
+
+// compareReports matches files of two reports by name, sorted by change kind and then name
+func compareReports(base, head *CodecovReport) []fileDelta {
+	byName := map[string]*fileDelta{}
+	for i := range base.Files {
+		file := &base.Files[i]
+		byName[file.Name] = &fileDelta{Name: file.Name, Change: changeRemoved, Base: file}
+	}
+	for i := range head.Files {
+		file := &head.Files[i]
+		delta, ok := byName[file.Name]
+		if !ok {
+			byName[file.Name] = &fileDelta{Name: file.Name, Change: changeAdded, Head: file}
+			continue
+		}
+		delta.Head = file
+		switch {
+		case file.Totals.Coverage > delta.Base.Totals.Coverage:
+			delta.Change = changeImproved
+		case file.Totals.Coverage < delta.Base.Totals.Coverage:
+			delta.Change = changeRegressed
+		default:
+			delta.Change = changeUnchanged
+		}
+	}
+
+	deltas := make([]fileDelta, 0, len(byName))
+	for _, delta := range byName {
+		deltas = append(deltas, *delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Change != deltas[j].Change {
+			return changeOrder[deltas[i].Change] < changeOrder[deltas[j].Change]
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+	return deltas
+}
+
+// countChanges returns the number of files per change kind
+func countChanges(deltas []fileDelta) map[string]int {
+	counts := map[string]int{}
+	for _, delta := range deltas {
+		counts[delta.Change]++
+	}
+	return counts
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func formatFileCoverage(file *FileCoverage) string {
+	if file == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", file.Totals.Coverage)
+}
+
+func formatFileDelta(delta fileDelta) string {
+	d, ok := delta.Delta()
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f", d)
+}
+
+func writeComparisonText(w io.Writer, c *coverageComparison) error {
+	fmt.Fprintf(w, "Coverage of %s from %s (%s) to %s (%s): %.2f%% -> %.2f%% (%+.2f)\n",
+		c.Repo, c.BaseRef, shortSHA(c.BaseSHA), c.HeadRef, shortSHA(c.HeadSHA),
+		c.Base.Totals.Coverage, c.Head.Totals.Coverage, c.Head.Totals.Coverage-c.Base.Totals.Coverage)
+
+	counts := countChanges(c.Files)
+	fmt.Fprintf(w, "%d regressed, %d removed, %d added, %d improved\n\n",
+		counts[changeRegressed], counts[changeRemoved], counts[changeAdded], counts[changeImproved])
+
+	fmt.Fprintln(w, "File, Change, Base, Head, Delta")
+	for _, delta := range c.Files {
+		fmt.Fprintf(w, "%s, %s, %s, %s, %s\n", delta.Name, delta.Change, formatFileCoverage(delta.Base), formatFileCoverage(delta.Head), formatFileDelta(delta))
+	}
+	return nil
+}
+
+func writeComparisonCSV(w io.Writer, c *coverageComparison) error {
+	coverage := func(file *FileCoverage) string {
+		if file == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.2f", file.Totals.Coverage)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"File", "Change", "Base Coverage %", "Head Coverage %", "Delta"})
+	for _, delta := range c.Files {
+		d := ""
+		if value, ok := delta.Delta(); ok {
+			d = fmt.Sprintf("%.2f", value)
+		}
+		writer.Write([]string{delta.Name, delta.Change, coverage(delta.Base), coverage(delta.Head), d})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeComparisonJSON(w io.Writer, c *coverageComparison) error {
+	type jsonRef struct {
+		Ref      string  `json:"ref"`
+		SHA      string  `json:"sha"`
+		Coverage float64 `json:"coverage"`
+	}
+	type jsonFile struct {
+		Name   string   `json:"name"`
+		Change string   `json:"change"`
+		Base   *float64 `json:"base"`
+		Head   *float64 `json:"head"`
+		Delta  *float64 `json:"delta"`
+	}
+
+	coverage := func(file *FileCoverage) *float64 {
+		if file == nil {
+			return nil
+		}
+		value := file.Totals.Coverage
+		return &value
+	}
+
+	files := make([]jsonFile, 0, len(c.Files))
+	for _, delta := range c.Files {
+		entry := jsonFile{Name: delta.Name, Change: delta.Change, Base: coverage(delta.Base), Head: coverage(delta.Head)}
+		if value, ok := delta.Delta(); ok {
+			entry.Delta = &value
+		}
+		files = append(files, entry)
+	}
+
+	return writeJSON(w, struct {
+		Repository string         `json:"repository"`
+		Base       jsonRef        `json:"base"`
+		Head       jsonRef        `json:"head"`
+		Summary    map[string]int `json:"summary"`
+		Files      []jsonFile     `json:"files"`
+	}{
+		Repository: c.Repo,
+		Base:       jsonRef{c.BaseRef, c.BaseSHA, c.Base.Totals.Coverage},
+		Head:       jsonRef{c.HeadRef, c.HeadSHA, c.Head.Totals.Coverage},
+		Summary:    countChanges(c.Files),
+		Files:      files,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveRef(t *testing.T) {
+	refs := map[string]string{
+		"main":       "mainsha",
+		"v1.0":       "tagsha",
+		"2024-01-01": "branchsha", // a branch named like a date
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/myorg/myrepo/commits/", func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Path[len("/repos/myorg/myrepo/commits/"):]
+		sha, ok := refs[ref]
+		if !ok {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "No commit found for SHA: ` + ref + `"}`))
+			return
+		}
+		w.Write([]byte(sha))
+	})
+	mux.HandleFunc("/repos/myorg/myrepo/commits", func(w http.ResponseWriter, r *http.Request) {
+		until, err := time.Parse(time.RFC3339, r.URL.Query().Get("until"))
+		if want := time.Date(2024, 2, 1, 23, 59, 59, 0, time.Local); err != nil || !until.Equal(want) {
+			t.Errorf("listing commits until %q, want %s", r.URL.Query().Get("until"), want.Format(time.RFC3339))
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"sha": "datesha"}]`))
+	})
+	ghClient := newTestGitHubClient(t, mux)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "main", want: "mainsha"},
+		{ref: "v1.0", want: "tagsha"},
+		{ref: "2024-01-01", want: "branchsha"},
+		{ref: "2024-02-01", want: "datesha"},
+		{ref: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := resolveRef(context.Background(), ghClient, "myorg", "myrepo", tt.ref)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolveRef(%q) = %q, %v, want %q (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	file := func(name string, coverage float64) FileCoverage {
+		f := FileCoverage{Name: name}
+		f.Totals.Coverage = coverage
+		return f
+	}
+	base := &CodecovReport{Files: []FileCoverage{file("same.go", 50), file("down.go", 80), file("up.go", 10), file("gone.go", 30)}}
+	head := &CodecovReport{Files: []FileCoverage{file("same.go", 50), file("down.go", 70), file("up.go", 20), file("new.go", 90)}}
+
+	var got []string
+	for _, delta := range compareReports(base, head) {
+		got = append(got, delta.Change+" "+delta.Name)
+	}
+	want := []string{"regressed down.go", "removed gone.go", "added new.go", "improved up.go", "unchanged same.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareReports() = %q, want %q", got, want)
+	}
+}
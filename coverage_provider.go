@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CoverageProvider is a coverage reporting service that can be queried for a repo
+type CoverageProvider interface {
+	// Name returns the provider name as used in flags
+	Name() string
+	// RepoCoverage returns the coverage of a repo branch, with a status explaining missing
+	// coverage. A non-empty sha pins it to that commit instead of the latest one reported.
+	RepoCoverage(org, repo, branch, sha string) RepoCoverage
+	// DetailedReport returns the per-file coverage report for a repo branch or commit
+	DetailedReport(org, repo, branch, sha string) (*CodecovReport, error)
+}
+
+// codecovProvider reads coverage from the Codecov API
+type codecovProvider struct {
+	token string
+}
+
+func (p *codecovProvider) Name() string { return "codecov" }
+
+func (p *codecovProvider) RepoCoverage(org, repo, branch, sha string) RepoCoverage {
+	return getRepoCoverage(org, repo, branch, sha, p.token)
+}
+
+func (p *codecovProvider) DetailedReport(org, repo, branch, sha string) (*CodecovReport, error) {
+	return getDetailedCoverageReport(org, repo, branch, sha, p.token)
+}
+
+// newCoverageProvider builds a provider by name, reading its token from the environment
+func newCoverageProvider(name string) (CoverageProvider, error) {
+	switch name {
+	case "codecov":
+		token := os.Getenv("CODECOV_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("please set the CODECOV_TOKEN environment variable")
+		}
+		return &codecovProvider{token: token}, nil
+	case "coveralls":
+		// public repos can be read without a token
+		return &coverallsProvider{token: os.Getenv("COVERALLS_TOKEN")}, nil
+	case "sonarqube":
+		token := os.Getenv("SONAR_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("please set the SONAR_TOKEN environment variable")
+		}
+		host := os.Getenv("SONAR_HOST_URL")
+		if host == "" {
+			host = sonarCloudURL
+		}
+		return &sonarqubeProvider{host: strings.TrimSuffix(host, "/"), token: token}, nil
+	case "coverprofile":
+		// coverprofiles downloaded from CI, see coverprofileProvider
+		dir := os.Getenv("COVERPROFILE_DIR")
+		if dir == "" {
+			dir = "."
+		}
+		return &coverprofileProvider{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown coverage provider %q", name)
+	}
+}
+
+// ProviderSelector picks the coverage provider for each repo
+type ProviderSelector struct {
+	Default CoverageProvider
+	Orgs    map[string]CoverageProvider
+	Repos   map[string]CoverageProvider
+}
+
+// For returns the provider configured for a repo, by "org/repo" or bare repo name, then
+// the one configured for its org, falling back to the default
+func (s *ProviderSelector) For(target repoTarget) CoverageProvider {
+	if p, ok := s.Repos[target.FullName()]; ok {
+		return p
+	}
+	if p, ok := s.Repos[target.Name]; ok {
+		return p
+	}
+	if p, ok := s.Orgs[target.Org]; ok {
+		return p
+	}
+	return s.Default
+}
+
+// newProviderSelector parses the default provider and "org=provider,..." and
+// "repo=provider,..." override lists, where repo is either "org/repo" or a bare repo name
+func newProviderSelector(defaultName, orgOverrides, repoOverrides string) (*ProviderSelector, error) {
+	// share one instance per provider name between orgs and repos
+	byName := map[string]CoverageProvider{}
+	get := func(name string) (CoverageProvider, error) {
+		if p, ok := byName[name]; ok {
+			return p, nil
+		}
+		p, err := newCoverageProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		byName[name] = p
+		return p, nil
+	}
+
+	def, err := get(defaultName)
+	if err != nil {
+		return nil, err
+	}
+	selector := &ProviderSelector{Default: def}
+	if selector.Orgs, err = parseProviderOverrides(orgOverrides, "org", get); err != nil {
+		return nil, err
+	}
+	if selector.Repos, err = parseProviderOverrides(repoOverrides, "repo", get); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// parseProviderOverrides parses a "key=provider,..." list, where kind names the key in errors
+func parseProviderOverrides(overrides, kind string, get func(name string) (CoverageProvider, error)) (map[string]CoverageProvider, error) {
+	providers := map[string]CoverageProvider{}
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, name, ok := strings.Cut(entry, "=")
+		if !ok || key == "" || name == "" {
+			return nil, fmt.Errorf("invalid %s provider %q, expected %s=provider", kind, entry, kind)
+		}
+		p, err := get(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		providers[strings.TrimSpace(key)] = p
+	}
+	return providers, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveJSON returns a handler answering every request with status and body encoded as JSON
+func serveJSON(t *testing.T, status int, body interface{}) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if body != nil {
+			if err := json.NewEncoder(w).Encode(body); err != nil {
+				t.Errorf("encoding response: %v", err)
+			}
+		}
+	}
+}
+
+func TestProviderSelectorFor(t *testing.T) {
+	t.Setenv("CODECOV_TOKEN", "codecov-token")
+	t.Setenv("SONAR_TOKEN", "sonar-token")
+
+	selector, err := newProviderSelector("codecov", "other=sonarqube", "myorg/special=coveralls,bare=coverprofile,other/pinned=codecov")
+	if err != nil {
+		t.Fatalf("newProviderSelector: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target repoTarget
+		want   string
+	}{
+		{"default", repoTarget{Org: "myorg", Name: "plain"}, "codecov"},
+		{"repo by full name", repoTarget{Org: "myorg", Name: "special"}, "coveralls"},
+		{"full name of another org", repoTarget{Org: "elsewhere", Name: "special"}, "codecov"},
+		{"repo by bare name", repoTarget{Org: "anyorg", Name: "bare"}, "coverprofile"},
+		{"org", repoTarget{Org: "other", Name: "plain"}, "sonarqube"},
+		{"repo overrides org", repoTarget{Org: "other", Name: "pinned"}, "codecov"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selector.For(tt.target).Name(); got != tt.want {
+				t.Errorf("For(%s) = %s, want %s", tt.target.FullName(), got, tt.want)
+			}
+		})
+	}
+
+	if selector.Repos["other/pinned"] != selector.Default {
+		t.Errorf("providers with the same name should share one instance")
+	}
+}
+
+func TestNewProviderSelectorErrors(t *testing.T) {
+	t.Setenv("CODECOV_TOKEN", "codecov-token")
+	t.Setenv("SONAR_TOKEN", "")
+
+	tests := []struct {
+		name        string
+		defaultName string
+		orgs        string
+		repos       string
+	}{
+		{"unknown default", "nope", "", ""},
+		{"unknown repo provider", "codecov", "", "repo=nope"},
+		{"missing token", "codecov", "org=sonarqube", ""},
+		{"org without provider", "codecov", "org=", ""},
+		{"repo without separator", "codecov", "", "repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProviderSelector(tt.defaultName, tt.orgs, tt.repos); err == nil {
+				t.Errorf("newProviderSelector(%q, %q, %q) succeeded, want an error", tt.defaultName, tt.orgs, tt.repos)
+			}
+		})
+	}
+}
+
+func TestCodecovProviderRepoCoverage(t *testing.T) {
+	commits := serveJSON(t, http.StatusOK, map[string]interface{}{
+		"results": []map[string]interface{}{
+			{"commitid": "head", "totals": map[string]interface{}{"coverage": 81.5}},
+			{"commitid": "older", "totals": nil},
+		},
+	})
+	notFound := serveJSON(t, http.StatusNotFound, nil)
+
+	tests := []struct {
+		name         string
+		list         http.HandlerFunc // commits of the branch
+		commit       http.HandlerFunc // the commit looked up by sha
+		sha          string
+		wantStatus   CoverageStatus
+		wantCoverage float64
+	}{
+		{
+			name:         "latest commit",
+			list:         commits,
+			wantStatus:   StatusCovered,
+			wantCoverage: 81.5,
+		},
+		{
+			name:       "no commits",
+			list:       serveJSON(t, http.StatusOK, map[string]interface{}{"results": []interface{}{}}),
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:         "pinned commit",
+			commit:       serveJSON(t, http.StatusOK, map[string]interface{}{"commitid": "abc", "totals": map[string]interface{}{"coverage": 64}}),
+			sha:          "abc",
+			wantStatus:   StatusCovered,
+			wantCoverage: 64,
+		},
+		{
+			name:       "pinned commit without report",
+			commit:     serveJSON(t, http.StatusOK, map[string]interface{}{"commitid": "abc", "totals": nil}),
+			sha:        "abc",
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:       "pinned commit with zero coverage",
+			commit:     serveJSON(t, http.StatusOK, map[string]interface{}{"commitid": "abc", "totals": map[string]interface{}{"coverage": 0}}),
+			sha:        "abc",
+			wantStatus: StatusZeroCoverage,
+		},
+		{
+			name:       "commit unknown to codecov",
+			list:       commits,
+			commit:     notFound,
+			sha:        "abc",
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:       "commit of an unknown repo",
+			list:       notFound,
+			commit:     notFound,
+			sha:        "abc",
+			wantStatus: StatusNotConfigured,
+		},
+		{
+			name:       "pinned commit error",
+			commit:     serveJSON(t, http.StatusInternalServerError, nil),
+			sha:        "abc",
+			wantStatus: StatusTransientError,
+		},
+		{
+			name:       "unknown repo",
+			list:       notFound,
+			wantStatus: StatusNotConfigured,
+		},
+		{
+			name:       "bad token",
+			list:       serveJSON(t, http.StatusUnauthorized, nil),
+			wantStatus: StatusAuthError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/myorg/repos/myrepo/commits", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("branch") != "main" {
+					t.Errorf("list request auth %q branch %q", r.Header.Get("Authorization"), r.URL.Query().Get("branch"))
+				}
+				tt.list(w, r)
+			})
+			mux.HandleFunc("/myorg/repos/myrepo/commits/abc", func(w http.ResponseWriter, r *http.Request) {
+				tt.commit(w, r)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			defer func(base string) { codecovAPIBase = base }(codecovAPIBase)
+			codecovAPIBase = server.URL
+
+			p := &codecovProvider{token: "secret"}
+			got := p.RepoCoverage("myorg", "myrepo", "main", tt.sha)
+			if got.Status != tt.wantStatus || got.Coverage != tt.wantCoverage {
+				t.Errorf("RepoCoverage() = %v %.2f, want %v %.2f (err %v)", got.Status, got.Coverage, tt.wantStatus, tt.wantCoverage, got.Err)
+			}
+		})
+	}
+}
+
+func TestCodecovProviderDetailedReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/myorg/repos/myrepo/report" || r.URL.Query().Get("sha") != "abc" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		page := map[string]interface{}{
+			"totals": map[string]interface{}{"coverage": 75},
+			"files":  []map[string]interface{}{{"name": "a.go"}},
+		}
+		if r.URL.Query().Get("page") == "1" {
+			page["next"] = "page 2"
+		} else {
+			page["files"] = []map[string]interface{}{{"name": "b.go"}}
+		}
+		serveJSON(t, http.StatusOK, page)(w, r)
+	}))
+	defer server.Close()
+	defer func(base string) { codecovReportAPIBase = base }(codecovReportAPIBase)
+	codecovReportAPIBase = server.URL
+
+	p := &codecovProvider{token: "secret"}
+	report, err := p.DetailedReport("myorg", "myrepo", "main", "abc")
+	if err != nil {
+		t.Fatalf("DetailedReport: %v", err)
+	}
+	if report.Totals.Coverage != 75 || len(report.Files) != 2 || report.Files[1].Name != "b.go" {
+		t.Errorf("DetailedReport() = %+v, want both pages at 75%%", report)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Coveralls API base URLs for repos and for builds by commit; variables so tests can
+// point them at a fake server
+var (
+	coverallsAPIBase   = "https://coveralls.io/github"
+	coverallsBuildsAPI = "https://coveralls.io/builds"
+)
+
+// coverallsProvider reads coverage from the latest Coveralls build of a repo
+type coverallsProvider struct {
+	token string
+}
+
+func (p *coverallsProvider) Name() string { return "coveralls" }
+
+// Fetch the build coverage of a commit, or of the latest build for a repository
+func (p *coverallsProvider) RepoCoverage(org, repo, branch, sha string) RepoCoverage {
+	url := fmt.Sprintf("%s/%s/%s.json", coverallsAPIBase, org, repo)
+	if sha != "" {
+		url = fmt.Sprintf("%s/%s.json", coverallsBuildsAPI, sha)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	if p.token != "" {
+		req.Header.Set("Authorization", "token "+p.token)
+	}
+	if sha == "" {
+		setBranchQuery(req, branch)
+	}
+
+	resp, err := providerHTTPClient.Do(req)
+	if err != nil {
+		return errorResult(repo, err)
+	}
+	defer resp.Body.Close()
+
+	// a missing build means nothing was uploaded for the commit, if the repo itself is known
+	if sha != "" && resp.StatusCode == http.StatusNotFound {
+		latest := p.RepoCoverage(org, repo, branch, "")
+		if latest.Status.IsError() || latest.Status == StatusNotConfigured {
+			return latest
+		}
+		return RepoCoverage{Name: repo, Commit: sha, Status: StatusNoUploads}
+	}
+	if resp.StatusCode != 200 {
+		return errorResult(repo, &APIError{Service: "coveralls", StatusCode: resp.StatusCode})
+	}
+
+	var build struct {
+		CoveredPercent *float64 `json:"covered_percent"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&build); err != nil {
+		return errorResult(repo, fmt.Errorf("error decoding Coveralls response: %v", err))
+	}
+
+	if build.CoveredPercent == nil {
+		return RepoCoverage{Name: repo, Commit: sha, Status: StatusNoUploads}
+	}
+
+	result := coverageResult(repo, *build.CoveredPercent)
+	result.Commit = sha
+	return result
+}
+
+// Coveralls does not expose per-file totals through its public API
+func (p *coverallsProvider) DetailedReport(org, repo, branch, sha string) (*CodecovReport, error) {
+	return nil, fmt.Errorf("detailed reports are not supported by coveralls (%s)", repo)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCoverallsProviderRepoCoverage(t *testing.T) {
+	tests := []struct {
+		name         string
+		sha          string
+		repo         http.HandlerFunc
+		build        http.HandlerFunc
+		wantStatus   CoverageStatus
+		wantCoverage float64
+	}{
+		{
+			name:         "latest build",
+			repo:         serveJSON(t, http.StatusOK, map[string]interface{}{"covered_percent": 64.2}),
+			wantStatus:   StatusCovered,
+			wantCoverage: 64.2,
+		},
+		{
+			name:       "repo without builds",
+			repo:       serveJSON(t, http.StatusOK, map[string]interface{}{"covered_percent": nil}),
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:       "unknown repo",
+			repo:       serveJSON(t, http.StatusNotFound, nil),
+			wantStatus: StatusNotConfigured,
+		},
+		{
+			name:         "build of a commit",
+			sha:          "abc",
+			build:        serveJSON(t, http.StatusOK, map[string]interface{}{"covered_percent": 90}),
+			wantStatus:   StatusCovered,
+			wantCoverage: 90,
+		},
+		{
+			name:       "commit without a build",
+			sha:        "abc",
+			build:      serveJSON(t, http.StatusNotFound, nil),
+			repo:       serveJSON(t, http.StatusOK, map[string]interface{}{"covered_percent": 64.2}),
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:       "commit of an unknown repo",
+			sha:        "abc",
+			build:      serveJSON(t, http.StatusNotFound, nil),
+			repo:       serveJSON(t, http.StatusNotFound, nil),
+			wantStatus: StatusNotConfigured,
+		},
+		{
+			name:       "bad token",
+			repo:       serveJSON(t, http.StatusForbidden, nil),
+			wantStatus: StatusAuthError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/github/myorg/myrepo.json", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "token secret" || r.URL.Query().Get("branch") != "main" {
+					t.Errorf("repo request auth %q branch %q", r.Header.Get("Authorization"), r.URL.Query().Get("branch"))
+				}
+				tt.repo(w, r)
+			})
+			mux.HandleFunc("/builds/abc.json", func(w http.ResponseWriter, r *http.Request) {
+				tt.build(w, r)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			defer func(repos, builds string) { coverallsAPIBase, coverallsBuildsAPI = repos, builds }(coverallsAPIBase, coverallsBuildsAPI)
+			coverallsAPIBase, coverallsBuildsAPI = server.URL+"/github", server.URL+"/builds"
+
+			p := &coverallsProvider{token: "secret"}
+			got := p.RepoCoverage("myorg", "myrepo", "main", tt.sha)
+			if got.Status != tt.wantStatus || got.Coverage != tt.wantCoverage {
+				t.Errorf("RepoCoverage() = %v %.2f, want %v %.2f (err %v)", got.Status, got.Coverage, tt.wantStatus, tt.wantCoverage, got.Err)
+			}
+			// coverage read for a commit is reported against it, repo errors are not
+			if got.Status != StatusNotConfigured && got.Commit != tt.sha {
+				t.Errorf("RepoCoverage() commit = %q, want %q", got.Commit, tt.sha)
+			}
+		})
+	}
+}
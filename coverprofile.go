@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profileBlock is one statement block of a Go coverprofile
+type profileBlock struct {
+	File      string
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+// parseCoverprofile reads the blocks of a `go test -coverprofile` file
+func parseCoverprofile(r io.Reader) ([]profileBlock, error) {
+	var blocks []profileBlock
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		block, err := parseProfileLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, scanner.Err()
+}
+
+// mergeBlocks adds up the counts of blocks that appear several times, as they do in
+// profiles written by several test binaries or concatenated from several runs
+func mergeBlocks(blocks []profileBlock) []profileBlock {
+	type blockKey struct {
+		file                                 string
+		startLine, startCol, endLine, endCol int
+	}
+	index := map[blockKey]int{}
+	var merged []profileBlock
+	for _, block := range blocks {
+		key := blockKey{block.File, block.StartLine, block.StartCol, block.EndLine, block.EndCol}
+		if i, ok := index[key]; ok {
+			merged[i].Count += block.Count
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, block)
+	}
+	return merged
+}
+
+// parseProfileLine parses "file.go:startLine.startCol,endLine.endCol numStmt count"
+func parseProfileLine(line string) (profileBlock, error) {
+	var b profileBlock
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return b, fmt.Errorf("invalid coverprofile line %q", line)
+	}
+	b.File = line[:colon]
+
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return b, fmt.Errorf("invalid coverprofile line %q", line)
+	}
+	start, end, ok := strings.Cut(fields[0], ",")
+	if !ok {
+		return b, fmt.Errorf("invalid coverprofile block %q", fields[0])
+	}
+
+	var err error
+	if b.StartLine, b.StartCol, err = parsePosition(start); err != nil {
+		return b, err
+	}
+	if b.EndLine, b.EndCol, err = parsePosition(end); err != nil {
+		return b, err
+	}
+	if b.NumStmt, err = strconv.Atoi(fields[1]); err != nil {
+		return b, fmt.Errorf("invalid statement count %q", fields[1])
+	}
+	if b.Count, err = strconv.Atoi(fields[2]); err != nil {
+		return b, fmt.Errorf("invalid hit count %q", fields[2])
+	}
+	return b, nil
+}
+
+func parsePosition(pos string) (int, int, error) {
+	line, col, ok := strings.Cut(pos, ".")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid position %q", pos)
+	}
+	l, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid position %q", pos)
+	}
+	c, err := strconv.Atoi(col)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid position %q", pos)
+	}
+	return l, c, nil
+}
+
+// trimModule turns an import path file name into a repo-relative path. Without a module,
+// the "github.com/org/repo/" prefix is removed.
+func trimModule(file, module string) string {
+	if module != "" {
+		return strings.TrimPrefix(file, strings.TrimSuffix(module, "/")+"/")
+	}
+	if strings.HasPrefix(file, "github.com/") {
+		if parts := strings.SplitN(file, "/", 4); len(parts) == 4 {
+			return parts[3]
+		}
+	}
+	return file
+}
+
+// profileReport maps coverprofile blocks to per-file totals weighted by statement, the
+// way `go tool cover -func` computes coverage: Lines counts the statements of a file,
+// Hits those of blocks that ran and Misses the rest.
+func profileReport(blocks []profileBlock, module string) *CodecovReport {
+	files := map[string]*FileCoverage{}
+	for _, block := range blocks {
+		if block.NumStmt == 0 {
+			continue
+		}
+		name := trimModule(block.File, module)
+		file, ok := files[name]
+		if !ok {
+			file = &FileCoverage{Name: name}
+			files[name] = file
+		}
+		file.Totals.Lines += block.NumStmt
+		if block.Count > 0 {
+			file.Totals.Hits += block.NumStmt
+		} else {
+			file.Totals.Misses += block.NumStmt
+		}
+	}
+
+	report := &CodecovReport{}
+	totalStmts, totalHits := 0, 0
+	for _, file := range files {
+		file.Totals.Coverage = percentage(file.Totals.Hits, file.Totals.Lines)
+		totalStmts += file.Totals.Lines
+		totalHits += file.Totals.Hits
+		report.Files = append(report.Files, *file)
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Name < report.Files[j].Name
+	})
+	report.Totals.Coverage = percentage(totalHits, totalStmts)
+	return report
+}
+
+// packageReport aggregates the files of a report by directory, i.e. by Go package
+func packageReport(report *CodecovReport) *CodecovReport {
+	byDir := map[string]*FileCoverage{}
+	for _, file := range report.Files {
+		dir := path.Dir(file.Name)
+		pkg, ok := byDir[dir]
+		if !ok {
+			pkg = &FileCoverage{Name: dir}
+			byDir[dir] = pkg
+		}
+		pkg.Totals.Lines += file.Totals.Lines
+		pkg.Totals.Hits += file.Totals.Hits
+		pkg.Totals.Misses += file.Totals.Misses
+	}
+
+	packages := &CodecovReport{Totals: report.Totals}
+	for _, pkg := range byDir {
+		pkg.Totals.Coverage = percentage(pkg.Totals.Hits, pkg.Totals.Lines)
+		packages.Files = append(packages.Files, *pkg)
+	}
+	sort.Slice(packages.Files, func(i, j int) bool {
+		return packages.Files[i].Name < packages.Files[j].Name
+	})
+	return packages
+}
+
+func percentage(hits, lines int) float64 {
+	if lines == 0 {
+		return 0
+	}
+	return float64(hits) / float64(lines) * 100
+}
+
+// loadCoverprofiles parses and merges coverprofile files into a report
+func loadCoverprofiles(filenames []string, module string) (*CodecovReport, error) {
+	var blocks []profileBlock
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		fileBlocks, err := parseCoverprofile(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+		}
+		blocks = append(blocks, fileBlocks...)
+	}
+	return profileReport(mergeBlocks(blocks), module), nil
+}
+
+// coverprofileProvider reads coverage from coverprofiles downloaded from CI, stored as
+// <dir>/<org>/<repo>.out or <dir>/<repo>.out
+type coverprofileProvider struct {
+	dir string
+}
+
+func (p *coverprofileProvider) Name() string { return "coverprofile" }
+
+// profilePath returns the coverprofile of a repo, or an empty string if there is none
+func (p *coverprofileProvider) profilePath(org, repo string) (string, error) {
+	for _, candidate := range []string{filepath.Join(p.dir, org, repo+".out"), filepath.Join(p.dir, repo+".out")} {
+		_, err := os.Stat(candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Coverprofiles are whatever CI produced, so branch and sha are not used
+func (p *coverprofileProvider) RepoCoverage(org, repo, branch, sha string) RepoCoverage {
+	report, err := p.DetailedReport(org, repo, branch, sha)
+	if err != nil {
+		return errorResult(repo, err)
+	}
+	if report == nil {
+		return RepoCoverage{Name: repo, Status: StatusNotConfigured}
+	}
+	return coverageResult(repo, report.Totals.Coverage)
+}
+
+func (p *coverprofileProvider) DetailedReport(org, repo, branch, sha string) (*CodecovReport, error) {
+	filename, err := p.profilePath(org, repo)
+	if err != nil || filename == "" {
+		return nil, err
+	}
+	return loadCoverprofiles([]string{filename}, "github.com/"+org+"/"+repo)
+}
+
+// runProfile implements the "profile" command, which reports coverage of local
+// coverprofiles without calling any API. It returns the process exit code.
+func runProfile(args []string) int {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	repoFlag := fs.String("repo", "", "Name of the repository as org/repo (default: derived from the module)")
+	module := fs.String("module", "", "Go module path to strip from file names (default: github.com/<org>/<repo>)")
+	verbose := fs.Bool("v", false, "Also write a detailed report next to the output")
+	packages := fs.Bool("packages", false, "Detailed report per package instead of per file")
+	format := fs.String("format", "text", "Report format: text, csv, json, markdown or html")
+	output := fs.String("output", "", "Write the summary report to this file instead of stdout; detailed reports go next to it")
+	policyFile := fs.String("policy", "", "YAML coverage policy to enforce; violations exit with status 4")
+	ignoreOpts := addIgnoreFlags(fs)
+	logOpts := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: profile [flags] coverprofile...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	reporter, err := newReporter(*format)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	var policy *Policy
+	if *policyFile != "" {
+		if policy, err = loadPolicy(*policyFile); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	org, repo := defaultOrg, ""
+	switch {
+	case *repoFlag != "":
+		var ok bool
+		if org, repo, ok = strings.Cut(*repoFlag, "/"); !ok {
+			org, repo = defaultOrg, *repoFlag
+		}
+	case strings.HasPrefix(*module, "github.com/"):
+		parts := strings.Split(*module, "/")
+		if len(parts) >= 3 {
+			org, repo = parts[1], parts[2]
+		}
+	}
+	if repo == "" {
+		log.Fatal("❌ Please set -repo or a github.com -module")
+	}
+	modulePath := *module
+	if modulePath == "" {
+		modulePath = "github.com/" + org + "/" + repo
+	}
+
+	report, err := loadCoverprofiles(fs.Args(), modulePath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	coverage := coverageResult(repo, report.Totals.Coverage)
+	coverage.Org = org
+	results := []repoResult{{Coverage: coverage, Report: report}}
+	adjustCoverage(results, ignoreOpts.patterns())
+	coverage, report = results[0].Coverage, results[0].Report
+
+	out := os.Stdout
+	reportDir := "."
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+		reportDir = filepath.Dir(*output)
+	}
+
+	if err := reporter.Summary(out, org, []RepoCoverage{coverage}); err != nil {
+		log.Fatalf("❌ Error writing report: %v", err)
+	}
+	if *verbose {
+		detailed := report
+		if *packages {
+			detailed = packageReport(report)
+		}
+		filename, err := generateDetailedReport(reporter, reportDir, coverage, detailed)
+		if err != nil {
+			log.Fatalf("❌ Error writing report: %v", err)
+		}
+		slog.Info("Detailed coverage report generated", "repo", coverage.FullName(), "file", filename)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing report: %v", err)
+		}
+	}
+
+	if policy != nil {
+		if violations := policy.Evaluate(results); len(violations) > 0 {
+			writeViolations(os.Stderr, violations)
+			return exitViolations
+		}
+	}
+	return exitOK
+}
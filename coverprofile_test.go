@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCoverprofile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    []profileBlock
+		wantErr bool
+	}{
+		{
+			name:    "blocks",
+			profile: "mode: set\ngithub.com/myorg/myrepo/pkg/a.go:3.14,5.2 2 1\n\ngithub.com/myorg/myrepo/main.go:10.1,12.3 4 0\n",
+			want: []profileBlock{
+				{File: "github.com/myorg/myrepo/pkg/a.go", StartLine: 3, StartCol: 14, EndLine: 5, EndCol: 2, NumStmt: 2, Count: 1},
+				{File: "github.com/myorg/myrepo/main.go", StartLine: 10, StartCol: 1, EndLine: 12, EndCol: 3, NumStmt: 4, Count: 0},
+			},
+		},
+		{name: "windows path", profile: `C:\src\a.go:1.1,2.2 1 3`, want: []profileBlock{{File: `C:\src\a.go`, StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 3}}},
+		{name: "missing count", profile: "a.go:1.1,2.2 1", wantErr: true},
+		{name: "missing file", profile: "1.1,2.2 1 1", wantErr: true},
+		{name: "bad position", profile: "a.go:1,2.2 1 1", wantErr: true},
+		{name: "bad statement count", profile: "a.go:1.1,2.2 x 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCoverprofile(strings.NewReader(tt.profile))
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCoverprofile() = %+v, %v, want %+v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfileReport(t *testing.T) {
+	// two test binaries covering different blocks, as `go test -coverpkg` writes them
+	profile := `mode: count
+github.com/myorg/myrepo/pkg/a.go:3.14,5.2 2 1
+github.com/myorg/myrepo/pkg/a.go:5.2,9.3 6 0
+github.com/myorg/myrepo/pkg/a.go:9.3,9.20 0 0
+github.com/myorg/myrepo/main.go:10.1,12.3 1 0
+github.com/myorg/myrepo/main.go:10.1,12.3 1 2
+github.com/myorg/myrepo/main.go:13.1,20.3 1 0
+`
+	blocks, err := parseCoverprofile(strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := profileReport(mergeBlocks(blocks), "github.com/myorg/myrepo")
+
+	// go tool cover -func: a.go 2/8 statements, main.go 1/2, total 3/10
+	tests := []struct {
+		name                string
+		stmts, hits, misses int
+		coverage            float64
+	}{
+		{"main.go", 2, 1, 1, 50},
+		{"pkg/a.go", 8, 2, 6, 25},
+	}
+	if len(report.Files) != len(tests) {
+		t.Fatalf("profileReport() files = %+v, want %d files", report.Files, len(tests))
+	}
+	for i, tt := range tests {
+		file := report.Files[i]
+		if file.Name != tt.name || file.Totals.Lines != tt.stmts || file.Totals.Hits != tt.hits || file.Totals.Misses != tt.misses || file.Totals.Coverage != tt.coverage {
+			t.Errorf("file %d = %+v, want %s with %d/%d statements (%.0f%%)", i, file, tt.name, tt.hits, tt.stmts, tt.coverage)
+		}
+	}
+	if report.Totals.Coverage != 30 {
+		t.Errorf("total coverage = %.2f, want 30", report.Totals.Coverage)
+	}
+}
+
+func TestTrimModule(t *testing.T) {
+	tests := []struct {
+		file, module, want string
+	}{
+		{"github.com/myorg/myrepo/pkg/a.go", "github.com/myorg/myrepo", "pkg/a.go"},
+		{"github.com/myorg/myrepo/pkg/a.go", "github.com/myorg/myrepo/", "pkg/a.go"},
+		{"github.com/myorg/myrepo/v2/a.go", "", "v2/a.go"},
+		{"example.com/mod/a.go", "", "example.com/mod/a.go"},
+		{"example.com/mod/a.go", "example.com/mod", "a.go"},
+	}
+	for _, tt := range tests {
+		if got := trimModule(tt.file, tt.module); got != tt.want {
+			t.Errorf("trimModule(%q, %q) = %q, want %q", tt.file, tt.module, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,15 @@
+// Run with the shared logger and repo selection: go run debug.go logging.go targets.go filters.go retry.go
 package main
 
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"sort"
 	"time"
@@ -31,43 +35,11 @@ type RepoCoverage struct {
 	Configured bool
 }
 
-// Fetch all repositories using pagination
-func getAllRepos(org, githubToken string) ([]string, error) {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
-	tc := oauth2.NewClient(ctx, ts)
-	ghClient := github.NewClient(tc)
-
-	var allRepos []string
-	opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}} // Fetch 100 repos per request
-
-	for {
-		repos, resp, err := ghClient.Repositories.ListByOrg(ctx, org, opts)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching repositories from GitHub: %v", err)
-		}
-
-		// Append repo names
-		for _, repo := range repos {
-			allRepos = append(allRepos, repo.GetName())
-		}
-
-		// Break loop if there are no more pages
-		if resp.NextPage == 0 {
-			break
-		}
-
-		// Move to next page
-		opts.Page = resp.NextPage
-	}
-
-	return allRepos, nil
-}
-
-// Fetch latest commit test coverage for a repository
-func getRepoCoverage(org, repo, token string) (float64, bool) {
+// Fetch latest commit test coverage of a branch for a repository
+func getRepoCoverage(org, repo, branch, token string) (float64, bool) {
 	// Construct the Codecov API URL
-	url := fmt.Sprintf("%s/%s/repos/%s/commits", codecovAPIBase, org, repo)
+	url := fmt.Sprintf("%s/%s/repos/%s/commits?branch=%s", codecovAPIBase, org, repo, neturl.QueryEscape(branch))
+	slog.Debug("Querying Codecov API", "url", url)
 
 	// Make HTTP request to Codecov API
 	req, _ := http.NewRequest("GET", url, nil)
@@ -80,6 +52,7 @@ func getRepoCoverage(org, repo, token string) (float64, bool) {
 	}
 	defer resp.Body.Close()
 
+	slog.Debug("Codecov API response", "status", resp.StatusCode)
 	if resp.StatusCode != 200 {
 		return 0, false
 	}
@@ -99,7 +72,13 @@ func getRepoCoverage(org, repo, token string) (float64, bool) {
 }
 
 func main() {
-	org := "openshift" // Organization name
+	targetOpts := addTargetFlags(flag.CommandLine)
+	logOpts := addLogFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
 	// Get API tokens from environment variables
 	githubToken := os.Getenv("GITHUB_TOKEN")
@@ -112,23 +91,35 @@ func main() {
 		log.Fatal("❌ Please set the CODECOV_TOKEN environment variable")
 	}
 
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: githubToken})
+	ghClient := github.NewClient(oauth2.NewClient(ctx, ts))
+
 	// Fetch repositories from GitHub
-	repos, err := getAllRepos(org, githubToken)
+	targets, err := targetOpts.resolve(ctx, ghClient)
 	if err != nil {
 		log.Fatalf("❌ Error getting repos: %v", err)
 	}
+	// Qualify names when scanning more than one org
+	multiOrg := len(orgNames(targets)) > 1
 
 	// Store coverage details
 	var coveredRepos []RepoCoverage
 	var notConfiguredRepos []RepoCoverage
 
 	// Fetch coverage for each repository
-	for _, repo := range repos {
-		coverage, configured := getRepoCoverage(org, repo, codecovToken)
+	for _, target := range targets {
+		coverage, configured := getRepoCoverage(target.Org, target.Name, target.Branch, codecovToken)
+
+		name := target.Name
+		if multiOrg {
+			name = target.FullName()
+		}
+
 		if configured {
-			coveredRepos = append(coveredRepos, RepoCoverage{Name: repo, Coverage: coverage, Configured: true})
+			coveredRepos = append(coveredRepos, RepoCoverage{Name: name, Coverage: coverage, Configured: true})
 		} else {
-			notConfiguredRepos = append(notConfiguredRepos, RepoCoverage{Name: repo, Coverage: 0, Configured: false})
+			notConfiguredRepos = append(notConfiguredRepos, RepoCoverage{Name: name, Coverage: 0, Configured: false})
 		}
 	}
 
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// repoFilter selects org repos by the metadata ListByOrg returns
+type repoFilter struct {
+	excludeArchived bool
+	excludeForks    bool
+	includeTopics   string
+	excludeTopics   string
+	languages       string
+	includeName     string
+	excludeName     string
+	maxPushAge      time.Duration
+
+	includeRe *regexp.Regexp
+	excludeRe *regexp.Regexp
+}
+
+// addFilterFlags registers the repo filter flags on fs
+func addFilterFlags(fs *flag.FlagSet) *repoFilter {
+	f := &repoFilter{}
+	fs.BoolVar(&f.excludeArchived, "exclude-archived", false, "Skip archived repositories")
+	fs.BoolVar(&f.excludeForks, "exclude-forks", false, "Skip forked repositories")
+	fs.StringVar(&f.includeTopics, "topic", "", "Only scan repositories with one of these comma-separated topics")
+	fs.StringVar(&f.excludeTopics, "exclude-topic", "", "Skip repositories with any of these comma-separated topics")
+	fs.StringVar(&f.languages, "language", "", "Only scan repositories whose primary language is one of these, e.g. Go,Python")
+	fs.StringVar(&f.includeName, "include", "", "Only scan repositories whose name matches this regular expression")
+	fs.StringVar(&f.excludeName, "exclude", "", "Skip repositories whose name matches this regular expression")
+	fs.DurationVar(&f.maxPushAge, "max-push-age", 0, "Skip repositories not pushed to within this duration, e.g. 8760h; repositories without a push time are kept")
+	return f
+}
+
+// compile validates the name expressions; it must be called before match
+func (f *repoFilter) compile() error {
+	var err error
+	if f.includeName != "" {
+		if f.includeRe, err = regexp.Compile(f.includeName); err != nil {
+			return fmt.Errorf("invalid -include expression: %v", err)
+		}
+	}
+	if f.excludeName != "" {
+		if f.excludeRe, err = regexp.Compile(f.excludeName); err != nil {
+			return fmt.Errorf("invalid -exclude expression: %v", err)
+		}
+	}
+	return nil
+}
+
+// match reports whether repo passes every filter
+func (f *repoFilter) match(repo *github.Repository, now time.Time) bool {
+	if f.excludeArchived && repo.GetArchived() {
+		return false
+	}
+	if f.excludeForks && repo.GetFork() {
+		return false
+	}
+	if f.includeTopics != "" && !hasAnyTopic(repo, splitList(f.includeTopics)) {
+		return false
+	}
+	if f.excludeTopics != "" && hasAnyTopic(repo, splitList(f.excludeTopics)) {
+		return false
+	}
+	if f.languages != "" && !containsFold(splitList(f.languages), repo.GetLanguage()) {
+		return false
+	}
+	if f.includeRe != nil && !f.includeRe.MatchString(repo.GetName()) {
+		return false
+	}
+	if f.excludeRe != nil && f.excludeRe.MatchString(repo.GetName()) {
+		return false
+	}
+	// repos never pushed to have no push time, and are kept rather than treated as ancient
+	if f.maxPushAge > 0 && repo.PushedAt != nil && now.Sub(repo.PushedAt.Time) > f.maxPushAge {
+		return false
+	}
+	return true
+}
+
+// hasAnyTopic reports whether repo is tagged with one of topics
+func hasAnyTopic(repo *github.Repository, topics []string) bool {
+	for _, topic := range repo.Topics {
+		if containsFold(topics, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+func TestRepoFilterMatch(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	pushed := func(age time.Duration) *github.Timestamp {
+		return &github.Timestamp{Time: now.Add(-age)}
+	}
+	repo := func(name string) *github.Repository {
+		return &github.Repository{
+			Name:     github.String(name),
+			Language: github.String("Go"),
+			Topics:   []string{"operator", "openshift"},
+			PushedAt: pushed(time.Hour),
+		}
+	}
+	with := func(r *github.Repository, change func(*github.Repository)) *github.Repository {
+		change(r)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		filter repoFilter
+		repo   *github.Repository
+		want   bool
+	}{
+		{"no filters", repoFilter{}, repo("api"), true},
+		{"no filters keep archived forks", repoFilter{}, with(repo("api"), func(r *github.Repository) {
+			r.Archived, r.Fork = github.Bool(true), github.Bool(true)
+		}), true},
+		{"archived excluded", repoFilter{excludeArchived: true}, with(repo("api"), func(r *github.Repository) { r.Archived = github.Bool(true) }), false},
+		{"active kept", repoFilter{excludeArchived: true}, repo("api"), true},
+		{"fork excluded", repoFilter{excludeForks: true}, with(repo("api"), func(r *github.Repository) { r.Fork = github.Bool(true) }), false},
+		{"source kept", repoFilter{excludeForks: true}, repo("api"), true},
+		{"topic included", repoFilter{includeTopics: "docs, Operator"}, repo("api"), true},
+		{"topic missing", repoFilter{includeTopics: "docs"}, repo("api"), false},
+		{"no topics", repoFilter{includeTopics: "operator"}, with(repo("api"), func(r *github.Repository) { r.Topics = nil }), false},
+		{"topic excluded", repoFilter{excludeTopics: "deprecated,openshift"}, repo("api"), false},
+		{"language included", repoFilter{languages: "python,go"}, repo("api"), true},
+		{"language missing", repoFilter{languages: "Python"}, repo("api"), false},
+		{"no language", repoFilter{languages: "Go"}, with(repo("api"), func(r *github.Repository) { r.Language = nil }), false},
+		{"name included", repoFilter{includeName: "-operator$"}, repo("cloud-ingress-operator"), true},
+		{"name not included", repoFilter{includeName: "-operator$"}, repo("operator-docs"), false},
+		{"name excluded", repoFilter{excludeName: "^(docs|test)-"}, repo("docs-site"), false},
+		{"name not excluded", repoFilter{excludeName: "^(docs|test)-"}, repo("site-docs"), true},
+		{"recent push", repoFilter{maxPushAge: 24 * time.Hour}, repo("api"), true},
+		{"old push", repoFilter{maxPushAge: 24 * time.Hour}, with(repo("api"), func(r *github.Repository) { r.PushedAt = pushed(48 * time.Hour) }), false},
+		{"never pushed", repoFilter{maxPushAge: 24 * time.Hour}, with(repo("api"), func(r *github.Repository) { r.PushedAt = nil }), true},
+		{"every filter passes", repoFilter{
+			excludeArchived: true,
+			excludeForks:    true,
+			includeTopics:   "operator",
+			excludeTopics:   "deprecated",
+			languages:       "go",
+			includeName:     "^api$",
+			excludeName:     "docs",
+			maxPushAge:      24 * time.Hour,
+		}, repo("api"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			if err := filter.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.match(tt.repo, now); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoFilterCompileErrors(t *testing.T) {
+	for _, filter := range []repoFilter{{includeName: "("}, {excludeName: "[a-"}} {
+		if err := filter.compile(); err == nil {
+			t.Errorf("compile(%+v) succeeded, want error", filter)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot file names sort in the order the snapshots were taken. Nanoseconds keep runs
+// started within the same second apart; parsing also accepts older names without them.
+const (
+	snapshotTimeFormat      = "20060102T150405.000000000Z"
+	snapshotParseTimeFormat = "20060102T150405.999999999Z"
+)
+
+// SnapshotRecord is one line of a snapshot file: the coverage of one repo at one point in time
+type SnapshotRecord struct {
+	Time     time.Time      `json:"time"`
+	Org      string         `json:"org"`
+	Repo     string         `json:"repo"`
+	Branch   string         `json:"branch,omitempty"`
+	Commit   string         `json:"commit,omitempty"`
+	Coverage float64        `json:"coverage"`
+	Raw      *float64       `json:"raw_coverage,omitempty"` // coverage before ignored files were excluded
+	Status   CoverageStatus `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Files    []FileCoverage `json:"files,omitempty"` // only recorded in verbose mode
+}
+
+// RawCoverage returns the coverage reported by the provider, including ignored files.
+// Whether files were ignored can change between runs, so trends compare raw coverage.
+func (r *SnapshotRecord) RawCoverage() float64 {
+	if r.Raw != nil {
+		return *r.Raw
+	}
+	return r.Coverage
+}
+
+// Snapshot is the coverage of every repo recorded by one run
+type Snapshot struct {
+	Time    time.Time
+	Records []SnapshotRecord
+}
+
+// saveSnapshot writes the results of a run to a new JSON-lines file in dir
+func saveSnapshot(dir string, at time.Time, results []repoResult) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// never overwrite another run's snapshot, even with a coarse clock
+	at = at.UTC()
+	var filename string
+	var file *os.File
+	for {
+		var err error
+		filename = filepath.Join(dir, at.Format(snapshotTimeFormat)+".jsonl")
+		file, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		at = at.Add(time.Nanosecond)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, result := range results {
+		record := SnapshotRecord{
+			Time:     at,
+			Org:      result.Coverage.Org,
+			Repo:     result.Coverage.Name,
+			Branch:   result.Coverage.Branch,
+			Commit:   result.Coverage.Commit,
+			Coverage: result.Coverage.Coverage,
+			Raw:      result.Coverage.RawCoverage,
+			Status:   result.Coverage.Status,
+		}
+		if result.Coverage.Err != nil {
+			record.Error = result.Coverage.Err.Error()
+		}
+		if result.Report != nil {
+			record.Files = result.Report.Files
+		}
+		if err := encoder.Encode(record); err != nil {
+			return "", err
+		}
+	}
+
+	return filename, file.Close()
+}
+
+// loadSnapshots reads every snapshot in dir, oldest first
+func loadSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		at, err := time.Parse(snapshotParseTimeFormat, strings.TrimSuffix(name, ".jsonl"))
+		if err != nil {
+			// not a snapshot file
+			continue
+		}
+
+		records, err := readSnapshotRecords(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{Time: at, Records: records})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// readSnapshotRecords reads the records of a single snapshot file
+func readSnapshotRecords(filename string) ([]SnapshotRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []SnapshotRecord
+	scanner := bufio.NewScanner(file)
+	// per-file coverage makes for long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record SnapshotRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveSnapshotSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	results := []repoResult{{Coverage: RepoCoverage{Org: "myorg", Name: "a", Coverage: 50, Status: StatusCovered}}}
+
+	first, err := saveSnapshot(dir, at, results)
+	if err != nil {
+		t.Fatalf("saveSnapshot: %v", err)
+	}
+	results[0].Coverage.Coverage = 60
+	second, err := saveSnapshot(dir, at, results)
+	if err != nil {
+		t.Fatalf("saveSnapshot: %v", err)
+	}
+	if first == second {
+		t.Fatalf("both snapshots were written to %s", first)
+	}
+
+	// a snapshot named by an older version, without nanoseconds
+	legacy := `{"time":"2024-02-01T00:00:00Z","org":"myorg","repo":"a","coverage":40,"status":"Covered"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "20240201T000000Z.jsonl"), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := loadSnapshots(dir)
+	if err != nil {
+		t.Fatalf("loadSnapshots: %v", err)
+	}
+	var got []float64
+	for _, snapshot := range snapshots {
+		got = append(got, snapshot.Records[0].Coverage)
+	}
+	if len(got) != 3 || got[0] != 40 || got[1] != 50 || got[2] != 60 {
+		t.Errorf("loaded coverage %v, want [40 50 60]", got)
+	}
+}
+
+func TestRepoTrendDelta(t *testing.T) {
+	raw := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name     string
+		baseline *SnapshotRecord
+		latest   *SnapshotRecord
+		want     float64
+		wantOK   bool
+	}{
+		{
+			name:     "plain coverage",
+			baseline: &SnapshotRecord{Coverage: 50, Status: StatusCovered},
+			latest:   &SnapshotRecord{Coverage: 55, Status: StatusCovered},
+			want:     5,
+			wantOK:   true,
+		},
+		{
+			name:     "ignored files in the latest run only",
+			baseline: &SnapshotRecord{Coverage: 50, Status: StatusCovered},
+			latest:   &SnapshotRecord{Coverage: 70, Raw: raw(48), Status: StatusCovered},
+			want:     -2,
+			wantOK:   true,
+		},
+		{
+			name:     "ignored files in both runs",
+			baseline: &SnapshotRecord{Coverage: 60, Raw: raw(50), Status: StatusCovered},
+			latest:   &SnapshotRecord{Coverage: 65, Raw: raw(51), Status: StatusCovered},
+			want:     1,
+			wantOK:   true,
+		},
+		{
+			name:   "missing baseline",
+			latest: &SnapshotRecord{Coverage: 55, Status: StatusCovered},
+			wantOK: false,
+		},
+		{
+			name:     "no uploads",
+			baseline: &SnapshotRecord{Coverage: 50, Status: StatusCovered},
+			latest:   &SnapshotRecord{Status: StatusNoUploads},
+			wantOK:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend := &repoTrend{Baseline: tt.baseline, Latest: tt.latest}
+			got, ok := trend.Delta()
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Delta() = %.2f %v, want %.2f %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLastSnapshotBefore(t *testing.T) {
+	oldLocal := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	t.Cleanup(func() { time.Local = oldLocal })
+
+	at := func(value string) Snapshot {
+		ts, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Snapshot{Time: ts}
+	}
+	snapshots := []Snapshot{
+		at("2024-03-01T10:00:00+02:00"),
+		at("2024-03-01T23:59:59.5+02:00"), // the last half second of March 1st
+		at("2024-03-01T22:30:00Z"),        // March 2nd in local time
+		at("2024-03-03T12:00:00+02:00"),
+	}
+
+	tests := []struct {
+		baseline string
+		want     int
+	}{
+		{"2024-02-29", -1},
+		{"2024-03-01", 1},
+		{"2024-03-02", 2},
+		{"2024-03-05", 3},
+		{"2024-03-01T10:00:00+02:00", 0},
+		{"2024-03-01T09:59:59+02:00", -1},
+		{"2024-03-01T22:30:00Z", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseline, func(t *testing.T) {
+			before, err := parseBaselineTime(tt.baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lastSnapshotBefore(snapshots, before); got != tt.want {
+				t.Errorf("lastSnapshotBefore(%s) = %d, want %d", before, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseBaselineTime("March 1st"); err == nil {
+		t.Error("parseBaselineTime accepted an invalid date")
+	}
+}
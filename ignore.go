@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// Generated, vendored and mock files of Kubernetes operators and protobuf APIs
+var defaultIgnoreGlobs = []string{
+	"**/zz_generated*.go",
+	"**/*.pb.go",
+	"**/*.pb.gw.go",
+	"**/*_generated.go",
+	"vendor/**",
+	"**/vendor/**",
+	"**/mocks/**",
+	"**/mock_*.go",
+	"**/*_mock.go",
+	"**/fake/**",
+}
+
+// ignoreOptions are the flags for excluding files when recomputing coverage
+type ignoreOptions struct {
+	excludeGenerated bool
+	globs            string
+}
+
+// addIgnoreFlags registers the ignore flags on fs
+func addIgnoreFlags(fs *flag.FlagSet) *ignoreOptions {
+	opts := &ignoreOptions{}
+	fs.BoolVar(&opts.excludeGenerated, "exclude-generated", false, "Recompute coverage without generated, vendored and mock files ("+strings.Join(defaultIgnoreGlobs, ", ")+")")
+	fs.StringVar(&opts.globs, "ignore", "", "Comma-separated file globs to exclude when recomputing coverage, e.g. **/testdata/**")
+	return opts
+}
+
+// patterns returns the compiled globs to ignore, or nil when coverage should not be
+// recomputed
+func (o *ignoreOptions) patterns() []*glob {
+	var patterns []string
+	if o.excludeGenerated {
+		patterns = append(patterns, defaultIgnoreGlobs...)
+	}
+	patterns = append(patterns, splitList(o.globs)...)
+
+	var globs []*glob
+	for _, pattern := range patterns {
+		globs = append(globs, compileGlob(pattern))
+	}
+	return globs
+}
+
+// ignored reports whether file matches one of globs
+func ignored(file string, globs []*glob) bool {
+	for _, glob := range globs {
+		if glob.Match(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterReport returns a copy of report without the ignored files, with totals
+// recomputed from the remaining line counts. It returns false if the report has no line
+// counts to recompute totals from.
+func filterReport(report *CodecovReport, globs []*glob) (*CodecovReport, bool) {
+	filtered := &CodecovReport{}
+	lines, hits := 0, 0
+	allLines := 0
+	for _, file := range report.Files {
+		allLines += file.Totals.Lines
+		if ignored(file.Name, globs) {
+			continue
+		}
+		filtered.Files = append(filtered.Files, file)
+		lines += file.Totals.Lines
+		hits += file.Totals.Hits
+	}
+	if allLines == 0 {
+		return report, false
+	}
+	filtered.Totals.Coverage = percentage(hits, lines)
+	return filtered, true
+}
+
+// adjustCoverage recomputes the coverage of results that have a detailed report without
+// the ignored files, keeping the provider's number as the raw coverage
+func adjustCoverage(results []repoResult, globs []*glob) {
+	if len(globs) == 0 {
+		return
+	}
+	for i := range results {
+		result := &results[i]
+		if result.Report == nil || !result.Coverage.Status.HasCoverage() {
+			continue
+		}
+		filtered, ok := filterReport(result.Report, globs)
+		if !ok {
+			continue
+		}
+
+		raw := result.Coverage.Coverage
+		adjusted := coverageResult(result.Coverage.Name, filtered.Totals.Coverage)
+		result.Coverage.Coverage = adjusted.Coverage
+		result.Coverage.Status = adjusted.Status
+		result.Coverage.RawCoverage = &raw
+		result.Report = filtered
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	opts := &ignoreOptions{excludeGenerated: true, globs: "**/testdata/**, cmd/*"}
+	globs := opts.patterns()
+
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"main.go", false},
+		{"api/v1/zz_generated.deepcopy.go", true},
+		{"pkg/proto/service.pb.go", true},
+		{"vendor/github.com/x/y.go", true},
+		{"pkg/mocks/client.go", true},
+		{"pkg/client/mock_client.go", true},
+		{"pkg/parser/testdata/input.go", true},
+		{"cmd/main.go", true},
+		{"cmd/tool/main.go", false},
+		{"pkg/generated_names.go", false},
+	}
+	for _, tt := range tests {
+		if got := ignored(tt.file, globs); got != tt.want {
+			t.Errorf("ignored(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+
+	if globs := (&ignoreOptions{}).patterns(); len(globs) != 0 {
+		t.Errorf("patterns() without flags = %v, want none", globs)
+	}
+}
+
+func TestAdjustCoverage(t *testing.T) {
+	file := func(name string, lines, hits int) FileCoverage {
+		f := FileCoverage{Name: name}
+		f.Totals.Lines, f.Totals.Hits, f.Totals.Misses = lines, hits, lines-hits
+		return f
+	}
+	globs := (&ignoreOptions{excludeGenerated: true}).patterns()
+
+	tests := []struct {
+		name     string
+		result   repoResult
+		want     float64
+		wantRaw  bool
+		wantFile int
+	}{
+		{
+			name: "generated files excluded",
+			result: repoResult{
+				Coverage: RepoCoverage{Name: "a", Coverage: 40, Status: StatusCovered},
+				Report:   &CodecovReport{Files: []FileCoverage{file("main.go", 10, 8), file("zz_generated.deepcopy.go", 10, 0)}},
+			},
+			want:     80,
+			wantRaw:  true,
+			wantFile: 1,
+		},
+		{
+			name: "no line counts",
+			result: repoResult{
+				Coverage: RepoCoverage{Name: "a", Coverage: 40, Status: StatusCovered},
+				Report:   &CodecovReport{Files: []FileCoverage{{Name: "main.go"}}},
+			},
+			want:     40,
+			wantFile: 1,
+		},
+		{
+			name:   "no report",
+			result: repoResult{Coverage: RepoCoverage{Name: "a", Coverage: 40, Status: StatusCovered}},
+			want:   40,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := []repoResult{tt.result}
+			adjustCoverage(results, globs)
+			got := results[0]
+			if got.Coverage.Coverage != tt.want || (got.Coverage.RawCoverage != nil) != tt.wantRaw {
+				t.Errorf("adjusted coverage = %.2f (raw %v), want %.2f (raw %v)", got.Coverage.Coverage, got.Coverage.RawCoverage, tt.want, tt.wantRaw)
+			}
+			if tt.wantRaw && *got.Coverage.RawCoverage != tt.result.Coverage.Coverage {
+				t.Errorf("raw coverage = %.2f, want %.2f", *got.Coverage.RawCoverage, tt.result.Coverage.Coverage)
+			}
+			if got.Report != nil && len(got.Report.Files) != tt.wantFile {
+				t.Errorf("report files = %+v, want %d", got.Report.Files, tt.wantFile)
+			}
+		})
+	}
+}
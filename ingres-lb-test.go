@@ -6,10 +6,10 @@ package osde2etests
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"os"
 	"time"
 
 	cloudingressv1alpha1 "github.com/openshift/cloud-ingress-operator/api/v1alpha1"
@@ -19,23 +19,12 @@ import (
 	"github.com/openshift/cloud-ingress-operator/config"
 	"github.com/openshift/osde2e-common/pkg/clients/openshift"
 
-	"golang.org/x/oauth2/google"
-	computev1 "google.golang.org/api/compute/v1"
-	"google.golang.org/api/option"
-
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	logger "sigs.k8s.io/controller-runtime/pkg/log"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/elb"
 )
 
 var _ = ginkgo.Describe("cloud-ingress-operator", ginkgo.Ordered, func() {
@@ -173,7 +162,7 @@ var _ = ginkgo.Describe("cloud-ingress-operator", ginkgo.Ordered, func() {
 	ginkgo.It("should resolve rh-api endpoint hostname", func(ctx context.Context) {
 		var err error
 		wait.PollUntilContextTimeout(ctx, 30*time.Second, 15*time.Minute, true, func(ctx context.Context) (bool, error) {
-			rhApiHostname, err := getLBForService(ctx, k8s, rhApiSvcNamespace, cioServiceName, true)
+			rhApiHostname, err := getLBForService(ctx, k8s, rhApiSvcNamespace, cioServiceName)
 			Expect(err).NotTo(HaveOccurred(), "Could not get rh-api lb")
 			_, err = net.LookupHost(rhApiHostname)
 			if err != nil {
@@ -185,223 +174,32 @@ var _ = ginkgo.Describe("cloud-ingress-operator", ginkgo.Ordered, func() {
 	})
 
 	ginkgo.It("manually deleted "+cioServiceName+" load balancer should be recreated", func(ctx context.Context) {
-		if provider == "aws" {
-			awsAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
-			awsSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-			awsToken := os.Getenv("AWS_SESSION_TOKEN") // Added session token
-			Expect(awsAccessKey).NotTo(BeEmpty(), "awsAccessKey not found")
-			Expect(awsSecretKey).NotTo(BeEmpty(), "awsSecretKey not found")
-
-			ginkgo.By("Getting old " + cioServiceName + " load balancer name")
-			oldLBName, err := getLBForService(ctx, k8s, rhApiSvcNamespace, cioServiceName, false)
-			Expect(err).NotTo(HaveOccurred(), "No existing "+cioServiceName+" service found")
-			log.Printf("Old load balancer name %s ", oldLBName)
-
-			// delete the load balancer in aws
-			awsSession, err := session.NewSession(&aws.Config{
-				Region: aws.String(region),
-			})
-			Expect(err).NotTo(HaveOccurred(), "Failed to create AWS session")
-		
-			// Verify credentials exist
-			_, err = awsSession.Config.Credentials.Get()
-			Expect(err).NotTo(HaveOccurred(), "No valid AWS credentials found")
-		
-			// Add retry logic for token expiration
-			awsSession.Config.Retryer = func() aws.RequestRetryer {
-				return client.DefaultRetryer{
-					NumMaxRetries:    3,
-					MinRetryDelay:   1 * time.Second,
-					MaxRetryDelay:   10 * time.Second,
-				}
-			}
-		
-			ginkgo.By("Initializing AWS ELB service")
-			lb := elb.New(awsSession)
-			input := &elb.DeleteLoadBalancerInput{
-				LoadBalancerName: aws.String(oldLBName),
-			}
-
-			// must store security groups associated with LB, so we can delete them
-			oldLBDesc, err := lb.DescribeLoadBalancersWithContext(ctx, &elb.DescribeLoadBalancersInput{
-				LoadBalancerNames: []*string{aws.String(oldLBName)},
-			})
-			Expect(err).NotTo(HaveOccurred(), "Could not describe old load balancer")
-			orphanSecGroupIds := oldLBDesc.LoadBalancerDescriptions[0].SecurityGroups
-
-			ginkgo.By("Deleting old " + cioServiceName + " load balancer")
-			_, err = lb.DeleteLoadBalancer(input)
-			Expect(err).NotTo(HaveOccurred(), "Could not delete "+cioServiceName+" lb")
-			log.Printf("Old " + cioServiceName + " load balancer delete initiated")
-
-			ginkgo.By("Waiting for " + cioServiceName + " service reconcile")
-			err = wait.PollUntilContextTimeout(ctx, 15*time.Second, 10*time.Minute, false, func(ctx2 context.Context) (bool, error) {
-				newLBName, err := getLBForService(ctx2, k8s, rhApiSvcNamespace, cioServiceName, false)
-				log.Printf("Looking for new load balancer")
-
-				if err != nil || newLBName == "" {
-					// either we couldn't retrieve the LB name, or it wasn't created yet
-					log.Printf("New load balancer not found yet...")
-					return false, nil
-				}
-				if newLBName != oldLBName {
-					// the LB was successfully recreated
-					log.Printf("Reconciliation succeeded. New load balancer name: %s", newLBName)
-					return true, nil
-				}
-				// the rh-api svc hasn't been deleted yet
-				log.Printf("Old " + cioServiceName + " service not deleted yet...")
-				return false, nil
-			})
-			Expect(err).NotTo(HaveOccurred(), cioServiceName+" service did not reconcile")
-
-			// old LB's security groups ("orphans") will leak if not explicitly deleted
-			// first, delete sec group rule references to the orphans
-			ec2Svc := ec2.New(awsSession)
-			ginkgo.By("Cleaning up references to security groups orphaned by old LB deletion")
-			err = deleteSecGroupReferencesToOrphans(ec2Svc, orphanSecGroupIds)
-			Expect(err).NotTo(HaveOccurred(), "Error cleaning up after test")
-
-			// then delete the orphaned sec groups themselves
-			for _, orphanSecGroupId := range orphanSecGroupIds {
-				_, err := ec2Svc.DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{
-					GroupId: aws.String(*orphanSecGroupId),
-				})
-				if err != nil {
-					log.Printf("Failed to delete security group %s: %s", *orphanSecGroupId, err)
-				} else {
-					log.Printf("Deleted orphaned security group %s", *orphanSecGroupId)
-				}
-			}
+		lbProvider, err := newLoadBalancerProvider(ctx, k8s, provider, region, rhApiSvcNamespace, cioServiceName)
+		if errors.Is(err, errUnsupportedProvider) {
+			ginkgo.Skip(err.Error())
 		}
+		Expect(err).NotTo(HaveOccurred(), "Could not initialize "+provider+" load balancer provider")
+
+		ginkgo.By("Getting old " + cioServiceName + " load balancer")
+		oldLB, err := lbProvider.Describe(ctx)
+		Expect(err).NotTo(HaveOccurred(), "No existing "+cioServiceName+" load balancer found")
+		log.Printf("Old load balancer: %s", oldLB)
+
+		ginkgo.By("Deleting old " + cioServiceName + " load balancer")
+		err = lbProvider.Delete(ctx, oldLB)
+		// even a partial deletion may leave orphans, and they must be cleaned up whether
+		// or not the load balancer is recreated
+		ginkgo.DeferCleanup(func(ctx context.Context) {
+			ginkgo.By("Cleaning up resources orphaned by the old load balancer deletion")
+			err := lbProvider.CleanupOrphans(ctx)
+			Expect(err).NotTo(HaveOccurred(), "Error cleaning up after test")
+		})
+		Expect(err).NotTo(HaveOccurred(), "Could not delete "+cioServiceName+" load balancer")
 
-		if provider == "gcp" {
-			region := os.Getenv("CLOUD_PROVIDER_REGION")
-			Expect(region).NotTo(BeEmpty(), "No CLOUD_PROVIDER_REGION set")
-
-			ginkgo.By("Getting current " + cioServiceName + " ip")
-			oldLBIP, err := getLBForService(ctx, k8s, rhApiSvcNamespace, cioServiceName, false)
-			Expect(err).NotTo(HaveOccurred(), "No existing "+cioServiceName+" service found")
-			log.Printf("Old forwarding rule IP:  %s ", oldLBIP)
-
-			ginkgo.By("Getting GCP creds")
-			gcpCreds, status := getGCPCreds(ctx, k8s)
-			Expect(status).To(BeTrue(), "GCP creds not created")
-			project := gcpCreds.ProjectID
-
-			ginkgo.By("Initializing GCP compute service")
-			computeService, err := computev1.NewService(ctx, option.WithCredentials(gcpCreds), option.WithScopes("https://www.googleapis.com/auth/compute"))
-			Expect(err).NotTo(HaveOccurred(), "Could not initialize GCP compute service")
-
-			ginkgo.By("Getting GCP forwarding rule for " + cioServiceName + "")
-			oldLB, err := getGCPForwardingRuleForIP(computeService, oldLBIP, project, region)
-			Expect(err).NotTo(HaveOccurred(), "Could not get forwarding rule for "+cioServiceName)
-
-			// There's no single command to delete a load balancer in GCP
-			// Deletion of any related cloud resources may delete in misconfiguration.
-			// Delete all GCP resources related to rh-api LB setup
-			ginkgo.By("Deleting GCP forwarding rule for " + cioServiceName)
-			if oldLB == nil {
-				log.Printf("GCP forwarding rule for " + cioServiceName + " does not exist; Skipping deletion ")
-			} else {
-				log.Printf("Old forwarding rule name:  %s ", oldLB.Name)
-				_, err = computeService.ForwardingRules.Get(project, region, oldLB.Name).Do()
-				if err != nil {
-					log.Printf("GCP forwarding rule for " + cioServiceName + " not found")
-				} else {
-					ginkgo.By("Deleting GCP forwarding rule for " + cioServiceName)
-					_, err = computeService.ForwardingRules.Delete(project, region, oldLB.Name).Do()
-					if err != nil {
-						log.Printf("Error deleting forwarding rule")
-					}
-				}
-
-				ginkgo.By("Deleting GCP backend service rule for " + cioServiceName)
-				_, err = computeService.BackendServices.Get(project, oldLB.Name).Do()
-				if err != nil {
-					log.Printf("GCP backend service already deleted. ")
-				} else {
-					_, err = computeService.BackendServices.Delete(project, oldLB.Name).Do()
-					if err != nil {
-						log.Printf("Error deleting backend service ")
-					}
-				}
-
-				ginkgo.By("Deleting GCP health check for " + cioServiceName + " ")
-				_, err = computeService.HealthChecks.Get(project, oldLB.Name).Do()
-				if err != nil {
-					log.Printf("GCP health check already deleted ")
-				} else {
-					_, err = computeService.HealthChecks.Delete(project, oldLB.Name).Do()
-					if err != nil {
-						log.Printf("Error deleting health check ")
-					}
-				}
-
-				ginkgo.By("Deleting GCP target pool for " + cioServiceName)
-				_, err = computeService.TargetPools.Get(project, region, oldLB.Name).Do()
-				if err != nil {
-					log.Printf("GCP target pool already deleted")
-				} else {
-					_, err = computeService.TargetPools.Delete(project, region, oldLB.Name).Do()
-					if err != nil {
-						log.Printf("Error deleting target pool")
-					}
-				}
-			}
-
-			ginkgo.By("Deleting GCP address for " + cioServiceName)
-			_, err = computeService.Addresses.Get(project, region, oldLBIP).Do()
-			if err != nil {
-				log.Printf("GCP IP address already deleted")
-			} else {
-				_, err = computeService.Addresses.Delete(project, region, oldLBIP).Do()
-				if err != nil {
-					log.Printf("Error deleting address")
-				}
-			}
-
-			newLBIP := ""
-			ginkgo.By("Waiting for " + cioServiceName + " service reconcile")
-			err = wait.PollUntilContextTimeout(ctx, 15*time.Second, 10*time.Minute, true, func(ctx context.Context) (bool, error) {
-				// Getting the newly created IP from rh-api service
-				ginkgo.By("Getting new " + cioServiceName + " IP from " + cioServiceName + " service")
-				newLBIP, err = getLBForService(ctx, k8s, rhApiSvcNamespace, cioServiceName, false)
-				if (err != nil) || (newLBIP == "") {
-					log.Printf("New " + cioServiceName + " svc not created yet...")
-					return false, nil
-				} else if newLBIP == oldLBIP {
-					log.Printf("Old " + cioServiceName + " svc not deleted yet...")
-					return false, nil
-				} else {
-					log.Printf("Found new " + cioServiceName + " svc!")
-					log.Printf("Reconciliation succeeded. New loadbalancer IP: %s ", newLBIP)
-					return true, nil
-				}
-			})
-			Expect(err).NotTo(HaveOccurred(), cioServiceName+" service did not reconcile")
-
-			ginkgo.By("Waiting for new " + cioServiceName + " forwarding rule")
-			err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 1*time.Minute, false, func(ctx context.Context) (bool, error) {
-				ginkgo.By("Polling GCP to get new forwarding rule for " + cioServiceName)
-				newLB, err := getGCPForwardingRuleForIP(computeService, newLBIP, project, region)
-				if err != nil || newLB == nil {
-					// Either we couldn't retrieve the LB, or it wasn't created yet
-					log.Printf("New forwarding rule not found yet...")
-					return false, nil
-				}
-				log.Printf("New lb name: %s ", newLB.Name)
-
-				if newLB.Name != oldLB.Name {
-					// A new LB was successfully recreated in GCP
-					return true, nil
-				}
-				// rh-api lb hasn't been deleted yet
-				log.Printf("Old forwarding rule not deleted yet...")
-				return false, nil
-			})
-			Expect(err).NotTo(HaveOccurred(), "New "+cioServiceName+" forwarding rule not created in GCP")
-		}
+		ginkgo.By("Waiting for " + cioServiceName + " service reconcile")
+		newLB, err := lbProvider.WaitRecreated(ctx, oldLB)
+		Expect(err).NotTo(HaveOccurred(), cioServiceName+" load balancer was not recreated")
+		log.Printf("Reconciliation succeeded. New load balancer: %s", newLB)
 	})
 
 	ginkgo.It("can be upgraded", func(ctx context.Context) {
@@ -411,8 +209,9 @@ var _ = ginkgo.Describe("cloud-ingress-operator", ginkgo.Ordered, func() {
 	})
 })
 
-// getLBForService retrieves the load balancer name or IP associated with a service of type LoadBalancer
-func getLBForService(ctx context.Context, k8s *openshift.Client, namespace string, service string, fullHostName bool) (string, error) {
+// getLBForService retrieves the load balancer IP (GCP, Azure) or hostname (AWS) associated with
+// a service of type LoadBalancer
+func getLBForService(ctx context.Context, k8s *openshift.Client, namespace string, service string) (string, error) {
 	svc := new(corev1.Service)
 	err := k8s.Get(ctx, service, namespace, svc)
 	if err != nil {
@@ -428,100 +227,13 @@ func getLBForService(ctx context.Context, k8s *openshift.Client, namespace strin
 		return "", nil
 	}
 
-	if fullHostName {
-		return ingressList[0].Hostname, nil
-	}
-
-	// for GCP
+	// for GCP and Azure
 	if len(ingressList[0].IP) > 0 {
 		return ingressList[0].IP, nil
 	}
 
-	// for aws
-	return ingressList[0].Hostname[0:32], nil
-}
-
-// deleteSecGroupReferencesToOrphans deletes any security group rules referencing the provided
-// security group IDs (assumed to be those of security groups "orphaned" by LB deletion)
-func deleteSecGroupReferencesToOrphans(ec2Svc *ec2.EC2, orphanSecGroupIds []*string) error {
-	for _, orphanSecGroupId := range orphanSecGroupIds {
-		// list all sec groups
-		secGroupsAll, err := ec2Svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
-		if err != nil {
-			return err
-		}
-
-		// now that we know which sec groups mention the orphan, we can modify them to remove
-		// the referencing rules
-		for _, secGroup := range secGroupsAll.SecurityGroups {
-			// define an "IpPermissions" pattern that matches all rules referencing orphan
-			orphanSecGroupIpPermissions := []*ec2.IpPermission{
-				{
-					IpProtocol:       aws.String("-1"), // Means "all protocols"
-					UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String(*orphanSecGroupId)}},
-				},
-			}
-
-			// delete all egress rules matching pattern
-			_, err = ec2Svc.RevokeSecurityGroupEgress(&ec2.RevokeSecurityGroupEgressInput{
-				GroupId:       aws.String(*secGroup.GroupId),
-				IpPermissions: orphanSecGroupIpPermissions,
-			})
-			if err == nil {
-				log.Printf("Removed egress rule referring to orphan from %s", *secGroup.GroupId)
-			} else if err.(awserr.Error).Code() != "InvalidPermission.NotFound" {
-				// since we're iterating over all security groups, RevokeSecurityGroup*gress
-				// will often throw InvalidPermission; this is expected behavior. if a different
-				// error arises, report it
-				log.Printf("Encountered error while removing egress rule from %s: %s", *secGroup.GroupId, err)
-			}
-
-			// delete all ingress rules matching pattern
-			_, err = ec2Svc.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
-				GroupId:       aws.String(*secGroup.GroupId),
-				IpPermissions: orphanSecGroupIpPermissions,
-			})
-			if err == nil {
-				log.Printf("Removed ingress rule referring to orphan from %s", *secGroup.GroupId)
-			} else if err.(awserr.Error).Code() != "InvalidPermission.NotFound" {
-				log.Printf("Encountered error while removing ingress rule from %s: %s", *secGroup.GroupId, err)
-			}
-		}
-	}
-	return nil
-}
-
-// get credential object to use in service initialization
-func getGCPCreds(ctx context.Context, k8s *openshift.Client) (*google.Credentials, bool) {
-	serviceAccountJSON := []byte(os.Getenv("GCP_CREDS_JSON"))
-	credentials, err := google.CredentialsFromJSON(
-		ctx, serviceAccountJSON,
-		computev1.ComputeScope)
-	if err != nil {
-		return nil, false
-	}
-	return credentials, true
-}
-
-// Get forwarding rule for rh-api load balancer in GCP
-func getGCPForwardingRuleForIP(computeService *computev1.Service, oldLBIP string, project string, region string) (*computev1.ForwardingRule, error) {
-	listCall := computeService.ForwardingRules.List(project, region)
-	response, err := listCall.Do()
-	var oldLB *computev1.ForwardingRule
-	if err != nil {
-		return nil, err
-	}
-
-	for _, lb := range response.Items {
-		// This list of forwardingrules (LBs) includes any service LBs
-		// for application routers so check the IP to identify
-		// the rh-api LB.
-		if lb.IPAddress == oldLBIP {
-			oldLB = lb
-		}
-	}
-
-	return oldLB, nil
+	// for aws; the load balancer name can't be derived from the hostname, see resolveLB
+	return ingressList[0].Hostname, nil
 }
 
 func makeApiScheme(name string) *cloudingressv1alpha1.APIScheme {
@@ -0,0 +1,507 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elb/elbiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/osde2e-common/pkg/clients/openshift"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Type of classic ELBs; ELBv2 load balancers report network, application or gateway
+const awsClassicLB = "classic"
+
+// Tags the cloud provider puts on the load balancers it creates for services
+const (
+	awsServiceNameTag   = "kubernetes.io/service-name" // value is <namespace>/<name>
+	awsClusterTagPrefix = "kubernetes.io/cluster/"     // followed by the infrastructure name
+)
+
+// Tagging API resource type of classic and ELBv2 load balancers
+const awsLoadBalancerResourceType = "elasticloadbalancing:loadbalancer"
+
+// awsLoadBalancerProvider manages the load balancer of a service, either a classic ELB
+// or an ELBv2 load balancer such as an NLB
+type awsLoadBalancerProvider struct {
+	svc     serviceLB
+	infraID string
+	elb     elbiface.ELBAPI
+	elbv2   elbv2iface.ELBV2API
+	ec2     ec2iface.EC2API
+	tagging resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+
+	// security groups of the deleted load balancer, which AWS does not delete with it,
+	// and the VPC they are in
+	orphanSecGroupIds []*string
+	vpcID             string
+}
+
+func newAWSLoadBalancerProvider(ctx context.Context, svc serviceLB, region string) (*awsLoadBalancerProvider, error) {
+	// the session reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	infraID, err := clusterInfraID(ctx, svc.k8s)
+	if err != nil {
+		return nil, err
+	}
+
+	awsSession, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+		// retry throttled requests and expired session tokens
+		Retryer: client.DefaultRetryer{
+			NumMaxRetries: 3,
+			MinRetryDelay: 1 * time.Second,
+			MaxRetryDelay: 10 * time.Second,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	if _, err := awsSession.Config.Credentials.Get(); err != nil {
+		return nil, fmt.Errorf("no valid AWS credentials found: %w", err)
+	}
+
+	return &awsLoadBalancerProvider{
+		svc:     svc,
+		infraID: infraID,
+		elb:     elb.New(awsSession),
+		elbv2:   elbv2.New(awsSession),
+		ec2:     ec2.New(awsSession),
+		tagging: resourcegroupstaggingapi.New(awsSession),
+	}, nil
+}
+
+// clusterInfraID returns the infrastructure name the cluster tags its cloud resources with
+func clusterInfraID(ctx context.Context, k8s *openshift.Client) (string, error) {
+	if err := configv1.AddToScheme(k8s.GetScheme()); err != nil {
+		return "", fmt.Errorf("unable to register configv1 api scheme: %w", err)
+	}
+	var infra configv1.Infrastructure
+	if err := k8s.Get(ctx, "cluster", "", &infra); err != nil {
+		return "", fmt.Errorf("could not get cluster infrastructure: %w", err)
+	}
+	if infra.Status.InfrastructureName == "" {
+		return "", fmt.Errorf("cluster infrastructure has no infrastructure name")
+	}
+	return infra.Status.InfrastructureName, nil
+}
+
+// awsLoadBalancer is a classic or ELBv2 load balancer
+type awsLoadBalancer struct {
+	Name           string
+	ARN            string
+	Type           string // awsClassicLB, or the ELBv2 type
+	DNSName        string
+	VPCID          string
+	SecurityGroups []*string
+}
+
+// resolveLB finds the load balancer serving the service among those tagged with its
+// name and the cluster, by the DNS name the service exposes. Load balancer names can't be
+// derived from DNS names: NLB hostnames and long names don't follow the ELB pattern.
+func (p *awsLoadBalancerProvider) resolveLB(ctx context.Context, dnsName string) (*awsLoadBalancer, error) {
+	var arns []string
+	err := p.tagging.GetResourcesPagesWithContext(ctx, &resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []*string{aws.String(awsLoadBalancerResourceType)},
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{
+			{Key: aws.String(awsServiceNameTag), Values: []*string{aws.String(p.svc.namespace + "/" + p.svc.name)}},
+			{Key: aws.String(awsClusterTagPrefix + p.infraID)},
+		},
+	}, func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
+		for _, resource := range page.ResourceTagMappingList {
+			arns = append(arns, aws.StringValue(resource.ResourceARN))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list load balancers tagged %s=%s/%s: %w", awsServiceNameTag, p.svc.namespace, p.svc.name, err)
+	}
+
+	// the tagging API lags behind deletions, so ARNs may belong to deleted load balancers,
+	// and a load balancer that can't be described must not hide the one serving the service
+	var errs []error
+	for _, arn := range arns {
+		lb, err := p.describeLB(ctx, arn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if lb != nil && strings.EqualFold(lb.DNSName, dnsName) {
+			return lb, nil
+		}
+	}
+	errs = append([]error{fmt.Errorf("none of the %d load balancers tagged for %s/%s has DNS name %s", len(arns), p.svc.namespace, p.svc.name, dnsName)}, errs...)
+	return nil, utilerrors.NewAggregate(errs)
+}
+
+// parseLBARN returns the name of the load balancer with the given ARN, and whether it is a
+// classic ELB. Classic ELB ARNs end in loadbalancer/<name>, ELBv2 ones in
+// loadbalancer/<net|app|gwy>/<name>/<id>.
+func parseLBARN(arn string) (name string, classic bool, err error) {
+	_, resource, found := strings.Cut(arn, ":loadbalancer/")
+	if strings.HasPrefix(arn, "arn:") && found {
+		switch parts := strings.Split(resource, "/"); {
+		case len(parts) == 1 && parts[0] != "":
+			return parts[0], true, nil
+		case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+			return parts[1], false, nil
+		}
+	}
+	return "", false, fmt.Errorf("%s is not a load balancer ARN", arn)
+}
+
+// describeLB describes the load balancer with the given ARN, or returns nil if it no
+// longer exists
+func (p *awsLoadBalancerProvider) describeLB(ctx context.Context, arn string) (*awsLoadBalancer, error) {
+	name, classic, err := parseLBARN(arn)
+	if err != nil {
+		return nil, err
+	}
+
+	if classic {
+		out, err := p.elb.DescribeLoadBalancersWithContext(ctx, &elb.DescribeLoadBalancersInput{
+			LoadBalancerNames: []*string{aws.String(name)},
+		})
+		if isAWSErrorCode(err, elb.ErrCodeAccessPointNotFoundException) || (err == nil && len(out.LoadBalancerDescriptions) == 0) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not describe load balancer %s: %w", name, err)
+		}
+		desc := out.LoadBalancerDescriptions[0]
+		return &awsLoadBalancer{
+			Name:           aws.StringValue(desc.LoadBalancerName),
+			ARN:            arn,
+			Type:           awsClassicLB,
+			DNSName:        aws.StringValue(desc.DNSName),
+			VPCID:          aws.StringValue(desc.VPCId),
+			SecurityGroups: desc.SecurityGroups,
+		}, nil
+	}
+
+	out, err := p.elbv2.DescribeLoadBalancersWithContext(ctx, &elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{aws.String(arn)},
+	})
+	if isAWSErrorCode(err, elbv2.ErrCodeLoadBalancerNotFoundException) || (err == nil && len(out.LoadBalancers) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not describe load balancer %s: %w", arn, err)
+	}
+	lb := out.LoadBalancers[0]
+	return &awsLoadBalancer{
+		Name:           aws.StringValue(lb.LoadBalancerName),
+		ARN:            arn,
+		Type:           aws.StringValue(lb.Type),
+		DNSName:        aws.StringValue(lb.DNSName),
+		VPCID:          aws.StringValue(lb.VpcId),
+		SecurityGroups: lb.SecurityGroups,
+	}, nil
+}
+
+// isAWSErrorCode reports whether err is an AWS error with the given code
+func isAWSErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
+
+func (p *awsLoadBalancerProvider) Describe(ctx context.Context) (*loadBalancerRef, error) {
+	hostname, err := p.svc.address(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hostname == "" {
+		return nil, fmt.Errorf("service %s has no load balancer", p.svc.name)
+	}
+	lb, err := p.resolveLB(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	return &loadBalancerRef{Name: lb.Name, Type: lb.Type, Address: hostname, ARN: lb.ARN}, nil
+}
+
+func (p *awsLoadBalancerProvider) Delete(ctx context.Context, ref *loadBalancerRef) error {
+	if ref.ARN == "" {
+		return fmt.Errorf("load balancer %s has no ARN", ref)
+	}
+	lb, err := p.describeLB(ctx, ref.ARN)
+	if err != nil {
+		return err
+	}
+	if lb == nil {
+		return fmt.Errorf("load balancer %s does not exist", ref.ARN)
+	}
+	// must store security groups associated with LB, so we can delete them
+	p.orphanSecGroupIds, p.vpcID = lb.SecurityGroups, lb.VPCID
+
+	if lb.Type == awsClassicLB {
+		_, err = p.elb.DeleteLoadBalancerWithContext(ctx, &elb.DeleteLoadBalancerInput{
+			LoadBalancerName: aws.String(lb.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("could not delete load balancer %s: %w", lb.Name, err)
+		}
+		log.Printf("Load balancer %s delete initiated", lb.Name)
+		return nil
+	}
+	return p.deleteELBv2(ctx, lb)
+}
+
+// deleteELBv2 deletes the listeners, target groups and then the ELBv2 load balancer
+// itself, waiting until it is gone
+func (p *awsLoadBalancerProvider) deleteELBv2(ctx context.Context, lb *awsLoadBalancer) error {
+	if err := deleteListeners(ctx, p.elbv2, lb.ARN); err != nil {
+		return err
+	}
+	if err := cleanupTargetGroups(ctx, p.elbv2, lb.ARN); err != nil {
+		return err
+	}
+
+	_, err := p.elbv2.DeleteLoadBalancerWithContext(ctx, &elbv2.DeleteLoadBalancerInput{
+		LoadBalancerArn: aws.String(lb.ARN),
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete load balancer %s: %w", lb.ARN, err)
+	}
+	log.Printf("Load balancer %s delete initiated", lb.ARN)
+
+	err = p.elbv2.WaitUntilLoadBalancersDeletedWithContext(ctx, &elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{aws.String(lb.ARN)},
+	})
+	if err != nil {
+		return fmt.Errorf("load balancer %s was not deleted: %w", lb.ARN, err)
+	}
+	log.Printf("Load balancer %s deleted", lb.ARN)
+	return nil
+}
+
+// WaitRecreated waits for a load balancer with a new ARN, which must be of the same
+// type as old: an NLB replaced by a classic ELB means the operator lost the service's
+// type annotation
+func (p *awsLoadBalancerProvider) WaitRecreated(ctx context.Context, old *loadBalancerRef) (*loadBalancerRef, error) {
+	if _, err := p.svc.waitNewAddress(ctx, old.Address); err != nil {
+		return nil, err
+	}
+
+	// the new load balancer is tagged shortly after it is created
+	var lb *loadBalancerRef
+	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var err error
+		lb, err = p.Describe(ctx)
+		if err != nil {
+			log.Printf("New load balancer not found yet: %s", err)
+			return false, nil
+		}
+		if lb.ARN == old.ARN {
+			log.Printf("Old load balancer %s not deleted yet...", old.Name)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new load balancer not found in AWS: %w", err)
+	}
+	if lb.Type != old.Type {
+		return nil, fmt.Errorf("load balancer %s was recreated as %s, want %s", lb.Name, lb.Type, old.Type)
+	}
+	return lb, nil
+}
+
+// CleanupOrphans deletes the security groups of the deleted load balancer, which would
+// leak otherwise. Groups that could not be deleted are kept for another attempt.
+func (p *awsLoadBalancerProvider) CleanupOrphans(ctx context.Context) error {
+	var errs []error
+	// first, delete sec group rule references to the orphans
+	if err := deleteSecGroupReferencesToOrphans(ctx, p.ec2, p.vpcID, p.orphanSecGroupIds); err != nil {
+		errs = append(errs, err)
+	}
+
+	// then delete the orphaned sec groups themselves
+	var remaining []*string
+	for _, orphanSecGroupId := range p.orphanSecGroupIds {
+		_, err := p.ec2.DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{
+			GroupId: orphanSecGroupId,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deleting security group %s: %w", aws.StringValue(orphanSecGroupId), err))
+			remaining = append(remaining, orphanSecGroupId)
+			continue
+		}
+		log.Printf("Deleted orphaned security group %s", aws.StringValue(orphanSecGroupId))
+	}
+	p.orphanSecGroupIds = remaining
+	if len(remaining) == 0 {
+		p.vpcID = ""
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteSecGroupReferencesToOrphans deletes the security group rules in vpcID referencing the
+// provided security group IDs (assumed to be those of security groups "orphaned" by LB
+// deletion), so the orphans can be deleted. Only the referencing group pairs are revoked;
+// other sources of the same rules are kept.
+func deleteSecGroupReferencesToOrphans(ctx context.Context, ec2Svc ec2iface.EC2API, vpcID string, orphanSecGroupIds []*string) error {
+	if len(orphanSecGroupIds) == 0 {
+		return nil
+	}
+	if vpcID == "" {
+		return fmt.Errorf("VPC of security groups %s is unknown", strings.Join(aws.StringValueSlice(orphanSecGroupIds), ", "))
+	}
+
+	var errs []error
+	for _, orphanSecGroupId := range aws.StringValueSlice(orphanSecGroupIds) {
+		for _, egress := range []bool{false, true} {
+			direction, filter := "ingress", "ip-permission.group-id"
+			if egress {
+				direction, filter = "egress", "egress.ip-permission.group-id"
+			}
+
+			// only list the sec groups with rules mentioning the orphan
+			var secGroups []*ec2.SecurityGroup
+			err := ec2Svc.DescribeSecurityGroupsPagesWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+				Filters: []*ec2.Filter{
+					{Name: aws.String("vpc-id"), Values: []*string{aws.String(vpcID)}},
+					{Name: aws.String(filter), Values: []*string{aws.String(orphanSecGroupId)}},
+				},
+			}, func(page *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+				secGroups = append(secGroups, page.SecurityGroups...)
+				return true
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("listing security groups with %s rules referring to %s: %w", direction, orphanSecGroupId, err))
+				continue
+			}
+
+			for _, secGroup := range secGroups {
+				secGroupId := aws.StringValue(secGroup.GroupId)
+				permissions := secGroup.IpPermissions
+				if egress {
+					permissions = secGroup.IpPermissionsEgress
+				}
+				orphanPermissions := permissionsReferencing(permissions, orphanSecGroupId)
+				if len(orphanPermissions) == 0 {
+					continue
+				}
+
+				if egress {
+					_, err = ec2Svc.RevokeSecurityGroupEgressWithContext(ctx, &ec2.RevokeSecurityGroupEgressInput{
+						GroupId:       aws.String(secGroupId),
+						IpPermissions: orphanPermissions,
+					})
+				} else {
+					_, err = ec2Svc.RevokeSecurityGroupIngressWithContext(ctx, &ec2.RevokeSecurityGroupIngressInput{
+						GroupId:       aws.String(secGroupId),
+						IpPermissions: orphanPermissions,
+					})
+				}
+				if err != nil {
+					errs = append(errs, fmt.Errorf("removing %s rules referring to %s from %s: %w", direction, orphanSecGroupId, secGroupId, err))
+					continue
+				}
+				log.Printf("Removed %d %s rules referring to orphan %s from %s", len(orphanPermissions), direction, orphanSecGroupId, secGroupId)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// permissionsReferencing returns the parts of permissions granting access to groupId: the
+// same protocol and ports, with only the group pairs naming groupId, so revoking them
+// leaves CIDR, prefix list and other group sources in place
+func permissionsReferencing(permissions []*ec2.IpPermission, groupId string) []*ec2.IpPermission {
+	var matching []*ec2.IpPermission
+	for _, permission := range permissions {
+		var pairs []*ec2.UserIdGroupPair
+		for _, pair := range permission.UserIdGroupPairs {
+			if aws.StringValue(pair.GroupId) == groupId {
+				pairs = append(pairs, &ec2.UserIdGroupPair{GroupId: pair.GroupId, UserId: pair.UserId})
+			}
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		matching = append(matching, &ec2.IpPermission{
+			IpProtocol:       permission.IpProtocol,
+			FromPort:         permission.FromPort,
+			ToPort:           permission.ToPort,
+			UserIdGroupPairs: pairs,
+		})
+	}
+	return matching
+}
+
+// deleteListeners deletes all listeners of an ELBv2 load balancer
+func deleteListeners(ctx context.Context, svc elbv2iface.ELBV2API, lbArn string) error {
+	var listeners []*elbv2.Listener
+	err := svc.DescribeListenersPagesWithContext(ctx, &elbv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(lbArn),
+	}, func(page *elbv2.DescribeListenersOutput, lastPage bool) bool {
+		listeners = append(listeners, page.Listeners...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list listeners of %s: %w", lbArn, err)
+	}
+
+	for _, listener := range listeners {
+		_, err := svc.DeleteListenerWithContext(ctx, &elbv2.DeleteListenerInput{
+			ListenerArn: listener.ListenerArn,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete listener %s: %w", aws.StringValue(listener.ListenerArn), err)
+		}
+		log.Printf("Deleted listener: %s", aws.StringValue(listener.ListenerArn))
+	}
+	return nil
+}
+
+// cleanupTargetGroups deletes the target groups of an ELBv2 load balancer. Target groups
+// in use by a listener can't be deleted, so delete the listeners first.
+func cleanupTargetGroups(ctx context.Context, svc elbv2iface.ELBV2API, lbArn string) error {
+	var targetGroups []*elbv2.TargetGroup
+	err := svc.DescribeTargetGroupsPagesWithContext(ctx, &elbv2.DescribeTargetGroupsInput{
+		LoadBalancerArn: aws.String(lbArn),
+	}, func(page *elbv2.DescribeTargetGroupsOutput, lastPage bool) bool {
+		targetGroups = append(targetGroups, page.TargetGroups...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list target groups of %s: %w", lbArn, err)
+	}
+
+	for _, tg := range targetGroups {
+		_, err := svc.DeleteTargetGroupWithContext(ctx, &elbv2.DeleteTargetGroupInput{
+			TargetGroupArn: tg.TargetGroupArn,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete target group %s: %w", aws.StringValue(tg.TargetGroupArn), err)
+		}
+		log.Printf("Deleted target group: %s", aws.StringValue(tg.TargetGroupArn))
+	}
+	return nil
+}
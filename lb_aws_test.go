@@ -0,0 +1,351 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+)
+
+func TestParseLBARN(t *testing.T) {
+	tests := []struct {
+		name        string
+		arn         string
+		wantName    string
+		wantClassic bool
+		wantErr     bool
+	}{
+		{
+			name:        "classic",
+			arn:         "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/a1b2c3d4e5f6",
+			wantName:    "a1b2c3d4e5f6",
+			wantClassic: true,
+		},
+		{
+			name:     "network",
+			arn:      "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/net/infra-abc-ext/0123456789abcdef",
+			wantName: "infra-abc-ext",
+		},
+		{
+			name:     "application",
+			arn:      "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/my-alb/0123456789abcdef",
+			wantName: "my-alb",
+		},
+		{name: "target group", arn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/tg/0123456789abcdef", wantErr: true},
+		{name: "listener", arn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:listener/net/lb/0123/4567", wantErr: true},
+		{name: "truncated ELBv2", arn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/net/lb", wantErr: true},
+		{name: "no name", arn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/", wantErr: true},
+		{name: "not an ARN", arn: "a1b2c3d4e5f6-123456789.us-east-1.elb.amazonaws.com", wantErr: true},
+		{name: "empty", arn: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, classic, err := parseLBARN(tt.arn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLBARN(%q) = %q, %v, want error", tt.arn, name, classic)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tt.wantName || classic != tt.wantClassic {
+				t.Errorf("parseLBARN(%q) = %q, %v, want %q, %v", tt.arn, name, classic, tt.wantName, tt.wantClassic)
+			}
+		})
+	}
+}
+
+func TestPermissionsReferencing(t *testing.T) {
+	pair := func(groupId string) *ec2.UserIdGroupPair {
+		return &ec2.UserIdGroupPair{GroupId: aws.String(groupId), UserId: aws.String("123456789012")}
+	}
+	permission := func(port int64, pairs ...*ec2.UserIdGroupPair) *ec2.IpPermission {
+		return &ec2.IpPermission{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(port),
+			ToPort:           aws.Int64(port),
+			UserIdGroupPairs: pairs,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		permissions []*ec2.IpPermission
+		want        []*ec2.IpPermission
+	}{
+		{name: "no permissions"},
+		{
+			name:        "other groups only",
+			permissions: []*ec2.IpPermission{permission(6443, pair("sg-other"))},
+		},
+		{
+			name:        "orphan only",
+			permissions: []*ec2.IpPermission{permission(6443, pair("sg-orphan"))},
+			want:        []*ec2.IpPermission{permission(6443, pair("sg-orphan"))},
+		},
+		{
+			name:        "other groups are kept",
+			permissions: []*ec2.IpPermission{permission(6443, pair("sg-other"), pair("sg-orphan"))},
+			want:        []*ec2.IpPermission{permission(6443, pair("sg-orphan"))},
+		},
+		{
+			name: "CIDR and prefix list sources are kept",
+			permissions: []*ec2.IpPermission{{
+				IpProtocol:       aws.String("tcp"),
+				FromPort:         aws.Int64(22623),
+				ToPort:           aws.Int64(22623),
+				IpRanges:         []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}},
+				Ipv6Ranges:       []*ec2.Ipv6Range{{CidrIpv6: aws.String("fd00::/8")}},
+				PrefixListIds:    []*ec2.PrefixListId{{PrefixListId: aws.String("pl-123")}},
+				UserIdGroupPairs: []*ec2.UserIdGroupPair{pair("sg-orphan")},
+			}},
+			want: []*ec2.IpPermission{permission(22623, pair("sg-orphan"))},
+		},
+		{
+			name: "matching permissions among several",
+			permissions: []*ec2.IpPermission{
+				permission(6443, pair("sg-orphan")),
+				permission(22623, pair("sg-other")),
+				permission(443, pair("sg-orphan"), pair("sg-other")),
+			},
+			want: []*ec2.IpPermission{
+				permission(6443, pair("sg-orphan")),
+				permission(443, pair("sg-orphan")),
+			},
+		},
+		{
+			name: "pair descriptions are dropped",
+			permissions: []*ec2.IpPermission{permission(6443, &ec2.UserIdGroupPair{
+				GroupId:     aws.String("sg-orphan"),
+				UserId:      aws.String("123456789012"),
+				Description: aws.String("from the load balancer"),
+			})},
+			want: []*ec2.IpPermission{permission(6443, pair("sg-orphan"))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := permissionsReferencing(tt.permissions, "sg-orphan")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("permissionsReferencing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const (
+	oldNLBARN = "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/net/a1b2/0123456789abcdef"
+	newNLBARN = "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/net/c3d4/fedcba9876543210"
+)
+
+// mockELBV2 holds ELBv2 load balancers with their listeners and target groups, recording
+// the calls deleting them. Calls it doesn't implement panic on the nil embedded API.
+type mockELBV2 struct {
+	elbv2iface.ELBV2API
+	lbs          map[string]*elbv2.LoadBalancer
+	listeners    map[string][]string // listener ARNs by load balancer ARN
+	targetGroups map[string][]string // target group ARNs by load balancer ARN
+	failListener bool
+	calls        []string
+}
+
+func (m *mockELBV2) DescribeLoadBalancersWithContext(ctx aws.Context, in *elbv2.DescribeLoadBalancersInput, opts ...request.Option) (*elbv2.DescribeLoadBalancersOutput, error) {
+	lb, ok := m.lbs[aws.StringValue(in.LoadBalancerArns[0])]
+	if !ok {
+		return nil, awserr.New(elbv2.ErrCodeLoadBalancerNotFoundException, "load balancer not found", nil)
+	}
+	return &elbv2.DescribeLoadBalancersOutput{LoadBalancers: []*elbv2.LoadBalancer{lb}}, nil
+}
+
+func (m *mockELBV2) DescribeListenersPagesWithContext(ctx aws.Context, in *elbv2.DescribeListenersInput, fn func(*elbv2.DescribeListenersOutput, bool) bool, opts ...request.Option) error {
+	var page elbv2.DescribeListenersOutput
+	for _, arn := range m.listeners[aws.StringValue(in.LoadBalancerArn)] {
+		page.Listeners = append(page.Listeners, &elbv2.Listener{ListenerArn: aws.String(arn)})
+	}
+	fn(&page, true)
+	return nil
+}
+
+func (m *mockELBV2) DeleteListenerWithContext(ctx aws.Context, in *elbv2.DeleteListenerInput, opts ...request.Option) (*elbv2.DeleteListenerOutput, error) {
+	if m.failListener {
+		return nil, errors.New("throttled")
+	}
+	m.calls = append(m.calls, "delete listener "+aws.StringValue(in.ListenerArn))
+	return &elbv2.DeleteListenerOutput{}, nil
+}
+
+func (m *mockELBV2) DescribeTargetGroupsPagesWithContext(ctx aws.Context, in *elbv2.DescribeTargetGroupsInput, fn func(*elbv2.DescribeTargetGroupsOutput, bool) bool, opts ...request.Option) error {
+	var page elbv2.DescribeTargetGroupsOutput
+	for _, arn := range m.targetGroups[aws.StringValue(in.LoadBalancerArn)] {
+		page.TargetGroups = append(page.TargetGroups, &elbv2.TargetGroup{TargetGroupArn: aws.String(arn)})
+	}
+	fn(&page, true)
+	return nil
+}
+
+func (m *mockELBV2) DeleteTargetGroupWithContext(ctx aws.Context, in *elbv2.DeleteTargetGroupInput, opts ...request.Option) (*elbv2.DeleteTargetGroupOutput, error) {
+	m.calls = append(m.calls, "delete target group "+aws.StringValue(in.TargetGroupArn))
+	return &elbv2.DeleteTargetGroupOutput{}, nil
+}
+
+func (m *mockELBV2) DeleteLoadBalancerWithContext(ctx aws.Context, in *elbv2.DeleteLoadBalancerInput, opts ...request.Option) (*elbv2.DeleteLoadBalancerOutput, error) {
+	arn := aws.StringValue(in.LoadBalancerArn)
+	m.calls = append(m.calls, "delete load balancer "+arn)
+	delete(m.lbs, arn)
+	return &elbv2.DeleteLoadBalancerOutput{}, nil
+}
+
+func (m *mockELBV2) WaitUntilLoadBalancersDeletedWithContext(ctx aws.Context, in *elbv2.DescribeLoadBalancersInput, opts ...request.WaiterOption) error {
+	if _, ok := m.lbs[aws.StringValue(in.LoadBalancerArns[0])]; ok {
+		return errors.New("load balancer still exists")
+	}
+	return nil
+}
+
+// mockTagging returns the given load balancer ARNs as tagged for the service
+type mockTagging struct {
+	resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+	arns []string
+}
+
+func (m *mockTagging) GetResourcesPagesWithContext(ctx aws.Context, in *resourcegroupstaggingapi.GetResourcesInput, fn func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool, opts ...request.Option) error {
+	var page resourcegroupstaggingapi.GetResourcesOutput
+	for _, arn := range m.arns {
+		page.ResourceTagMappingList = append(page.ResourceTagMappingList, &resourcegroupstaggingapi.ResourceTagMapping{ResourceARN: aws.String(arn)})
+	}
+	fn(&page, true)
+	return nil
+}
+
+// nlb returns an NLB with the given ARN and DNS name
+func nlb(arn, dnsName string) *elbv2.LoadBalancer {
+	name, _, _ := parseLBARN(arn)
+	return &elbv2.LoadBalancer{
+		LoadBalancerArn:  aws.String(arn),
+		LoadBalancerName: aws.String(name),
+		Type:             aws.String(elbv2.LoadBalancerTypeEnumNetwork),
+		DNSName:          aws.String(dnsName),
+		VpcId:            aws.String("vpc-1"),
+		SecurityGroups:   []*string{aws.String("sg-nlb")},
+	}
+}
+
+func TestAWSDeleteELBv2(t *testing.T) {
+	tests := []struct {
+		name         string
+		failListener bool
+		wantCalls    []string
+		wantErr      string
+	}{
+		{
+			name: "listeners, then target groups, then the load balancer",
+			wantCalls: []string{
+				"delete listener listener-6443",
+				"delete listener listener-22623",
+				"delete target group tg-6443",
+				"delete target group tg-22623",
+				"delete load balancer " + oldNLBARN,
+			},
+		},
+		{name: "listener deletion fails", failListener: true, wantErr: "failed to delete listener listener-6443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockELBV2{
+				lbs:          map[string]*elbv2.LoadBalancer{oldNLBARN: nlb(oldNLBARN, "a1b2.elb.us-east-1.amazonaws.com")},
+				listeners:    map[string][]string{oldNLBARN: {"listener-6443", "listener-22623"}},
+				targetGroups: map[string][]string{oldNLBARN: {"tg-6443", "tg-22623"}},
+				failListener: tt.failListener,
+			}
+			p := &awsLoadBalancerProvider{svc: serviceLB{name: "rh-api"}, elbv2: mock}
+
+			err := p.Delete(context.Background(), &loadBalancerRef{Name: "a1b2", ARN: oldNLBARN})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Delete() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, ok := mock.lbs[oldNLBARN]; !ok {
+					t.Error("load balancer deleted after a listener could not be")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mock.calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", mock.calls, tt.wantCalls)
+			}
+			if p.vpcID != "vpc-1" || len(p.orphanSecGroupIds) != 1 || aws.StringValue(p.orphanSecGroupIds[0]) != "sg-nlb" {
+				t.Errorf("orphans = %v in %s, want [sg-nlb] in vpc-1", aws.StringValueSlice(p.orphanSecGroupIds), p.vpcID)
+			}
+		})
+	}
+}
+
+func TestAWSWaitRecreatedNLB(t *testing.T) {
+	old := &loadBalancerRef{Name: "a1b2", Type: elbv2.LoadBalancerTypeEnumNetwork, Address: "a1b2.elb.us-east-1.amazonaws.com", ARN: oldNLBARN}
+	tests := []struct {
+		name    string
+		lbs     []*elbv2.LoadBalancer
+		wantARN string
+	}{
+		{
+			name: "new ARN",
+			// the tagging API still lists the deleted load balancer
+			lbs:     []*elbv2.LoadBalancer{nlb(newNLBARN, "c3d4.elb.us-east-1.amazonaws.com")},
+			wantARN: newNLBARN,
+		},
+		{
+			name: "same ARN",
+			lbs:  []*elbv2.LoadBalancer{nlb(oldNLBARN, "c3d4.elb.us-east-1.amazonaws.com")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockELBV2{lbs: map[string]*elbv2.LoadBalancer{}}
+			for _, lb := range tt.lbs {
+				mock.lbs[aws.StringValue(lb.LoadBalancerArn)] = lb
+			}
+			p := &awsLoadBalancerProvider{
+				svc: serviceLB{name: "rh-api", lookup: func(ctx context.Context) (string, error) {
+					return "c3d4.elb.us-east-1.amazonaws.com", nil
+				}},
+				elbv2:   mock,
+				tagging: &mockTagging{arns: []string{oldNLBARN, newNLBARN}},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			lb, err := p.WaitRecreated(ctx, old)
+			if tt.wantARN == "" {
+				if err == nil {
+					t.Fatalf("WaitRecreated() = %v, want error", lb)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lb.ARN != tt.wantARN || lb.Name != "c3d4" || lb.Type != old.Type {
+				t.Errorf("WaitRecreated() = %s %s, want network c3d4 %s", lb, lb.ARN, tt.wantARN)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v5"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// azureLoadBalancerProvider manages the rh-api part of the cluster's Azure load balancer.
+// Services don't get a load balancer of their own on Azure: each one adds a frontend IP
+// configuration, load-balancing rules and health probes to the shared cluster load
+// balancer, plus a public IP for the frontend.
+//
+// It reads AZURE_SUBSCRIPTION_ID and AZURE_RESOURCE_GROUP (the cluster's resource group),
+// and authenticates with azidentity's default credential chain (AZURE_CLIENT_ID,
+// AZURE_CLIENT_SECRET, AZURE_TENANT_ID, ...). Setting AZURE_RESOURCE_MANAGER_ENDPOINT
+// sends all requests to that endpoint instead of Azure with a static token, so the
+// provider can run against a local fake Resource Manager.
+type azureLoadBalancerProvider struct {
+	svc           serviceLB
+	resourceGroup string
+	loadBalancers *armnetwork.LoadBalancersClient
+	publicIPs     *armnetwork.PublicIPAddressesClient
+
+	// public IPs of deleted frontends that could not be deleted yet
+	orphanPublicIPs []string
+}
+
+// azureLBResources are the Azure resources serving one service IP
+type azureLBResources struct {
+	publicIP *armnetwork.PublicIPAddress
+	lb       *armnetwork.LoadBalancer
+	frontend *armnetwork.FrontendIPConfiguration
+	rules    []*armnetwork.LoadBalancingRule
+	probes   []*armnetwork.Probe
+}
+
+func newAzureLoadBalancerProvider(svc serviceLB) (*azureLoadBalancerProvider, error) {
+	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
+	resourceGroup := os.Getenv("AZURE_RESOURCE_GROUP")
+	if subscriptionID == "" || resourceGroup == "" {
+		return nil, fmt.Errorf("AZURE_SUBSCRIPTION_ID and AZURE_RESOURCE_GROUP must be set")
+	}
+
+	var cred azcore.TokenCredential
+	options := &arm.ClientOptions{}
+	if endpoint := os.Getenv("AZURE_RESOURCE_MANAGER_ENDPOINT"); endpoint != "" {
+		log.Printf("Using Azure Resource Manager endpoint %s", endpoint)
+		cred = staticTokenCredential{}
+		options.Cloud = cloud.Configuration{
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {Audience: endpoint, Endpoint: endpoint},
+			},
+		}
+		// fake endpoints usually serve plain HTTP and know no resource providers
+		options.InsecureAllowCredentialWithHTTP = true
+		options.DisableRPRegistration = true
+	} else {
+		var err error
+		cred, err = azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get Azure credentials: %w", err)
+		}
+	}
+
+	factory, err := armnetwork.NewClientFactory(subscriptionID, cred, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize Azure network clients: %w", err)
+	}
+	return &azureLoadBalancerProvider{
+		svc:           svc,
+		resourceGroup: resourceGroup,
+		loadBalancers: factory.NewLoadBalancersClient(),
+		publicIPs:     factory.NewPublicIPAddressesClient(),
+	}, nil
+}
+
+// staticTokenCredential authenticates to a fake Resource Manager, which accepts any token
+type staticTokenCredential struct{}
+
+func (staticTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "fake-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func (p *azureLoadBalancerProvider) Describe(ctx context.Context) (*loadBalancerRef, error) {
+	ip, err := p.svc.address(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ip == "" {
+		return nil, fmt.Errorf("service %s has no load balancer", p.svc.name)
+	}
+
+	resources, err := p.resolve(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	return &loadBalancerRef{Name: resourceName(resources.frontend.Name, resources.frontend.ID), Address: ip}, nil
+}
+
+// Delete removes the frontend IP configuration, its rules and the probes only they use
+// from the cluster load balancer, then deletes the frontend's public IP. Inbound NAT rules
+// and pools on the frontend are removed with it, and so is the frontend from outbound
+// rules, since Azure rejects a load balancer referencing a missing frontend.
+func (p *azureLoadBalancerProvider) Delete(ctx context.Context, lb *loadBalancerRef) error {
+	resources, err := p.resolve(ctx, lb.Address)
+	if err != nil {
+		return err
+	}
+	lbName := resourceName(resources.lb.Name, resources.lb.ID)
+	props := resources.lb.Properties
+	frontendID := resourceID(resources.frontend.ID)
+
+	removed := map[string]bool{frontendID: true}
+	for _, rule := range resources.rules {
+		removed[resourceID(rule.ID)] = true
+	}
+	for _, probe := range resources.probes {
+		removed[resourceID(probe.ID)] = true
+	}
+
+	var rules []*armnetwork.LoadBalancingRule
+	for _, rule := range props.LoadBalancingRules {
+		if removed[resourceID(rule.ID)] {
+			log.Printf("Deleting load-balancing rule %s", resourceName(rule.Name, rule.ID))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	var probes []*armnetwork.Probe
+	for _, probe := range props.Probes {
+		if removed[resourceID(probe.ID)] {
+			log.Printf("Deleting health probe %s", resourceName(probe.Name, probe.ID))
+			continue
+		}
+		probes = append(probes, probe)
+	}
+	var frontends []*armnetwork.FrontendIPConfiguration
+	for _, frontend := range props.FrontendIPConfigurations {
+		if removed[resourceID(frontend.ID)] {
+			log.Printf("Deleting frontend IP configuration %s", resourceName(frontend.Name, frontend.ID))
+			continue
+		}
+		frontends = append(frontends, frontend)
+	}
+	var natRules []*armnetwork.InboundNatRule
+	for _, rule := range props.InboundNatRules {
+		if rule.Properties != nil && rule.Properties.FrontendIPConfiguration != nil && resourceID(rule.Properties.FrontendIPConfiguration.ID) == frontendID {
+			log.Printf("Deleting inbound NAT rule %s", resourceName(rule.Name, rule.ID))
+			continue
+		}
+		natRules = append(natRules, rule)
+	}
+	var natPools []*armnetwork.InboundNatPool
+	for _, pool := range props.InboundNatPools {
+		if pool.Properties != nil && pool.Properties.FrontendIPConfiguration != nil && resourceID(pool.Properties.FrontendIPConfiguration.ID) == frontendID {
+			log.Printf("Deleting inbound NAT pool %s", resourceName(pool.Name, pool.ID))
+			continue
+		}
+		natPools = append(natPools, pool)
+	}
+	var outboundRules []*armnetwork.OutboundRule
+	for _, rule := range props.OutboundRules {
+		if rule.Properties == nil {
+			outboundRules = append(outboundRules, rule)
+			continue
+		}
+		var ruleFrontends []*armnetwork.SubResource
+		for _, frontend := range rule.Properties.FrontendIPConfigurations {
+			if resourceID(frontend.ID) != frontendID {
+				ruleFrontends = append(ruleFrontends, frontend)
+			}
+		}
+		if len(ruleFrontends) == 0 && len(rule.Properties.FrontendIPConfigurations) > 0 {
+			// an outbound rule needs at least one frontend
+			log.Printf("Deleting outbound rule %s", resourceName(rule.Name, rule.ID))
+			continue
+		}
+		rule.Properties.FrontendIPConfigurations = ruleFrontends
+		outboundRules = append(outboundRules, rule)
+	}
+	props.LoadBalancingRules, props.Probes, props.FrontendIPConfigurations = rules, probes, frontends
+	props.InboundNatRules, props.InboundNatPools, props.OutboundRules = natRules, natPools, outboundRules
+
+	poller, err := p.loadBalancers.BeginCreateOrUpdate(ctx, p.resourceGroup, lbName, *resources.lb, nil)
+	if err != nil {
+		return fmt.Errorf("could not update load balancer %s: %w", lbName, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("could not update load balancer %s: %w", lbName, err)
+	}
+	log.Printf("Removed %s from load balancer %s", lb.Name, lbName)
+
+	// the public IP can stay locked for a while after its frontend is gone; CleanupOrphans
+	// retries it once the service is reconciled
+	publicIPName := resourceName(resources.publicIP.Name, resources.publicIP.ID)
+	if err := p.deletePublicIP(ctx, publicIPName); err != nil {
+		log.Printf("Could not delete public IP %s yet: %s", publicIPName, err)
+		p.orphanPublicIPs = append(p.orphanPublicIPs, publicIPName)
+	}
+	return nil
+}
+
+// WaitRecreated waits for the service to get a new IP, then for the frontend and rules
+// serving it to exist on the load balancer
+func (p *azureLoadBalancerProvider) WaitRecreated(ctx context.Context, old *loadBalancerRef) (*loadBalancerRef, error) {
+	ip, err := p.svc.waitNewAddress(ctx, old.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var lb *loadBalancerRef
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		resources, err := p.resolve(ctx, ip)
+		if err != nil {
+			log.Printf("New frontend IP configuration not found yet: %s", err)
+			return false, nil
+		}
+		if len(resources.rules) == 0 {
+			log.Printf("Load-balancing rules of %s not created yet...", resourceName(resources.frontend.Name, resources.frontend.ID))
+			return false, nil
+		}
+		lb = &loadBalancerRef{Name: resourceName(resources.frontend.Name, resources.frontend.ID), Address: ip}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load balancer resources for %s not created in Azure: %w", ip, err)
+	}
+	return lb, nil
+}
+
+// CleanupOrphans deletes the public IPs Delete could not delete
+func (p *azureLoadBalancerProvider) CleanupOrphans(ctx context.Context) error {
+	var errs []error
+	for _, name := range p.orphanPublicIPs {
+		if err := p.deletePublicIP(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("deleting public IP %s: %w", name, err))
+			continue
+		}
+		log.Printf("Deleted orphaned public IP %s", name)
+	}
+	p.orphanPublicIPs = nil
+	return utilerrors.NewAggregate(errs)
+}
+
+// resolve finds the public IP with the given address, and the load balancer frontend,
+// rules and probes using it
+func (p *azureLoadBalancerProvider) resolve(ctx context.Context, ip string) (*azureLBResources, error) {
+	resources := &azureLBResources{}
+	pager := p.publicIPs.NewListPager(p.resourceGroup, nil)
+	for pager.More() && resources.publicIP == nil {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list public IPs: %w", err)
+		}
+		for _, publicIP := range page.Value {
+			if publicIP.Properties != nil && publicIP.Properties.IPAddress != nil && *publicIP.Properties.IPAddress == ip {
+				resources.publicIP = publicIP
+				break
+			}
+		}
+	}
+	if resources.publicIP == nil {
+		return nil, fmt.Errorf("no public IP with address %s in resource group %s", ip, p.resourceGroup)
+	}
+	publicIPName := resourceName(resources.publicIP.Name, resources.publicIP.ID)
+	if resources.publicIP.Properties.IPConfiguration == nil || resources.publicIP.Properties.IPConfiguration.ID == nil {
+		return nil, fmt.Errorf("public IP %s is not attached to a load balancer", publicIPName)
+	}
+
+	// the IP configuration is .../loadBalancers/<lb>/frontendIPConfigurations/<frontend>
+	frontendID := *resources.publicIP.Properties.IPConfiguration.ID
+	lbName, ok := resourceNameAfter(frontendID, "loadBalancers")
+	if !ok {
+		return nil, fmt.Errorf("public IP %s is attached to %s, not a load balancer", publicIPName, frontendID)
+	}
+	resp, err := p.loadBalancers.Get(ctx, p.resourceGroup, lbName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get load balancer %s: %w", lbName, err)
+	}
+	resources.lb = &resp.LoadBalancer
+	props := resources.lb.Properties
+	if props == nil {
+		return nil, fmt.Errorf("load balancer %s has no properties", lbName)
+	}
+
+	for _, frontend := range props.FrontendIPConfigurations {
+		if resourceID(frontend.ID) == resourceID(&frontendID) {
+			resources.frontend = frontend
+		}
+	}
+	if resources.frontend == nil {
+		return nil, fmt.Errorf("load balancer %s has no frontend IP configuration %s", lbName, frontendID)
+	}
+
+	// probes shared with rules of other frontends must stay
+	probeUsers := map[string]int{}
+	probeIDs := map[string]bool{}
+	for _, rule := range props.LoadBalancingRules {
+		if rule.Properties == nil {
+			continue
+		}
+		probe := ""
+		if rule.Properties.Probe != nil {
+			probe = resourceID(rule.Properties.Probe.ID)
+			probeUsers[probe]++
+		}
+		if rule.Properties.FrontendIPConfiguration == nil || resourceID(rule.Properties.FrontendIPConfiguration.ID) != resourceID(&frontendID) {
+			continue
+		}
+		resources.rules = append(resources.rules, rule)
+		if probe != "" {
+			probeIDs[probe] = true
+		}
+	}
+	for _, probe := range props.Probes {
+		id := resourceID(probe.ID)
+		if probeIDs[id] && probeUsers[id] == countRulesWithProbe(resources.rules, id) {
+			resources.probes = append(resources.probes, probe)
+		}
+	}
+	return resources, nil
+}
+
+// deletePublicIP deletes a public IP, treating one that is already gone as deleted
+func (p *azureLoadBalancerProvider) deletePublicIP(ctx context.Context, name string) error {
+	poller, err := p.publicIPs.BeginDelete(ctx, p.resourceGroup, name, nil)
+	if err == nil {
+		_, err = poller.PollUntilDone(ctx, nil)
+	}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// resourceID normalizes an Azure resource ID, which is case-insensitive, for comparisons
+func resourceID(id *string) string {
+	if id == nil {
+		return ""
+	}
+	return strings.ToLower(*id)
+}
+
+// resourceName returns the name of an Azure resource, falling back to the last segment of
+// its ID when the response omits the name
+func resourceName(name, id *string) string {
+	if name != nil {
+		return *name
+	}
+	if id == nil {
+		return ""
+	}
+	return (*id)[strings.LastIndex(*id, "/")+1:]
+}
+
+// countRulesWithProbe returns how many of rules use the probe with the given ID
+func countRulesWithProbe(rules []*armnetwork.LoadBalancingRule, probe string) int {
+	count := 0
+	for _, rule := range rules {
+		if rule.Properties.Probe != nil && resourceID(rule.Properties.Probe.ID) == probe {
+			count++
+		}
+	}
+	return count
+}
+
+// resourceNameAfter returns the segment following kind in an Azure resource ID, e.g. the
+// load balancer name of a frontend IP configuration ID
+func resourceNameAfter(id, kind string) (string, bool) {
+	parts := strings.Split(id, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if strings.EqualFold(parts[i], kind) {
+			return parts[i+1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,283 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	fakeAzureGroupPath = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network"
+	fakeAzureLBPath    = fakeAzureGroupPath + "/loadBalancers/cluster-lb"
+)
+
+// fakeARM serves the public IPs and the load balancer of one resource group, recording
+// load balancer updates and public IP deletions
+type fakeARM struct {
+	mu        sync.Mutex
+	publicIPs []map[string]any
+	lb        map[string]any
+	updated   bool
+	deleted   []string
+}
+
+func (f *fakeARM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body any
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == fakeAzureGroupPath+"/publicIPAddresses":
+		body = map[string]any{"value": f.publicIPs}
+	case r.Method == http.MethodGet && r.URL.Path == fakeAzureLBPath:
+		body = f.lb
+	case r.Method == http.MethodPut && r.URL.Path == fakeAzureLBPath:
+		var lb map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&lb); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lb["properties"].(map[string]any)["provisioningState"] = "Succeeded"
+		f.lb, f.updated = lb, true
+		body = lb
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, fakeAzureGroupPath+"/publicIPAddresses/"):
+		f.deleted = append(f.deleted, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, `{"error":{"code":"NotFound"}}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// newFakeARMProvider returns an Azure provider sending its requests to fake
+func newFakeARMProvider(t *testing.T, fake *fakeARM) *azureLoadBalancerProvider {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("AZURE_SUBSCRIPTION_ID", "sub")
+	t.Setenv("AZURE_RESOURCE_GROUP", "rg")
+	t.Setenv("AZURE_RESOURCE_MANAGER_ENDPOINT", srv.URL)
+
+	p, err := newAzureLoadBalancerProvider(serviceLB{name: "rh-api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func lbChild(kind, name string) map[string]any {
+	return map[string]any{"id": fakeAzureLBPath + "/" + kind + "/" + name}
+}
+
+func withName(resource map[string]any, name string, props map[string]any) map[string]any {
+	resource["name"] = name
+	resource["properties"] = props
+	return resource
+}
+
+// newFakeARM returns a resource group with the rh-api frontend api-fe and another service
+// frontend other-fe on cluster-lb. The rules of both frontends use shared-probe, and the
+// other frontend's rule uses otherProbe.
+func newFakeARM(otherProbe string) *fakeARM {
+	apiFE := fakeAzureLBPath + "/frontendIPConfigurations/api-fe"
+	rule := func(name, frontend, probe string) map[string]any {
+		return withName(lbChild("loadBalancingRules", name), name, map[string]any{
+			"frontendIPConfiguration": lbChild("frontendIPConfigurations", frontend),
+			"probe":                   lbChild("probes", probe),
+		})
+	}
+	natRule := func(name, frontend string) map[string]any {
+		return withName(lbChild("inboundNatRules", name), name, map[string]any{
+			"frontendIPConfiguration": lbChild("frontendIPConfigurations", frontend),
+		})
+	}
+	outboundRule := func(name string, frontends ...string) map[string]any {
+		var refs []any
+		for _, frontend := range frontends {
+			refs = append(refs, lbChild("frontendIPConfigurations", frontend))
+		}
+		return withName(lbChild("outboundRules", name), name, map[string]any{"frontendIPConfigurations": refs})
+	}
+
+	return &fakeARM{
+		publicIPs: []map[string]any{
+			{"name": "other-pip", "properties": map[string]any{"ipAddress": "20.0.0.2"}},
+			{"name": "api-pip", "properties": map[string]any{
+				"ipAddress": "20.0.0.1",
+				// Azure doesn't preserve the case of resource group names in IDs
+				"ipConfiguration": map[string]any{"id": strings.Replace(apiFE, "/resourceGroups/rg/", "/resourceGroups/RG/", 1)},
+			}},
+		},
+		lb: map[string]any{
+			"id":   fakeAzureLBPath,
+			"name": "cluster-lb",
+			"properties": map[string]any{
+				"frontendIPConfigurations": []any{
+					withName(lbChild("frontendIPConfigurations", "api-fe"), "api-fe", map[string]any{}),
+					withName(lbChild("frontendIPConfigurations", "other-fe"), "other-fe", map[string]any{}),
+				},
+				"loadBalancingRules": []any{
+					rule("api-6443", "api-fe", "api-probe"),
+					rule("api-22623", "api-fe", "shared-probe"),
+					rule("other-443", "other-fe", otherProbe),
+				},
+				"probes": []any{
+					withName(lbChild("probes", "api-probe"), "api-probe", map[string]any{}),
+					withName(lbChild("probes", "shared-probe"), "shared-probe", map[string]any{}),
+					withName(lbChild("probes", "other-probe"), "other-probe", map[string]any{}),
+				},
+				"inboundNatRules": []any{natRule("api-ssh", "api-fe"), natRule("other-ssh", "other-fe")},
+				"outboundRules": []any{
+					outboundRule("api-outbound", "api-fe"),
+					outboundRule("mixed-outbound", "api-fe", "other-fe"),
+				},
+			},
+		},
+	}
+}
+
+// names returns the names of a list of load balancer child resources, sorted
+func names(resources any) []string {
+	var out []string
+	list, _ := resources.([]any)
+	for _, resource := range list {
+		out = append(out, resource.(map[string]any)["name"].(string))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestAzureResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		ip         string
+		otherProbe string
+		wantRules  []string
+		wantProbes []string
+		wantErr    string
+	}{
+		{
+			name:       "probe shared with another frontend is kept",
+			ip:         "20.0.0.1",
+			otherProbe: "shared-probe",
+			wantRules:  []string{"api-22623", "api-6443"},
+			wantProbes: []string{"api-probe"},
+		},
+		{
+			name:       "probes used only by the frontend are removed",
+			ip:         "20.0.0.1",
+			otherProbe: "other-probe",
+			wantRules:  []string{"api-22623", "api-6443"},
+			wantProbes: []string{"api-probe", "shared-probe"},
+		},
+		{name: "unknown address", ip: "20.0.0.9", otherProbe: "other-probe", wantErr: "no public IP with address 20.0.0.9"},
+		{name: "unattached public IP", ip: "20.0.0.2", otherProbe: "other-probe", wantErr: "public IP other-pip is not attached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeARMProvider(t, newFakeARM(tt.otherProbe))
+			resources, err := p.resolve(context.Background(), tt.ip)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := resourceName(resources.frontend.Name, resources.frontend.ID); got != "api-fe" {
+				t.Errorf("frontend = %s, want api-fe", got)
+			}
+			var rules, probes []string
+			for _, rule := range resources.rules {
+				rules = append(rules, *rule.Name)
+			}
+			for _, probe := range resources.probes {
+				probes = append(probes, *probe.Name)
+			}
+			sort.Strings(rules)
+			sort.Strings(probes)
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", rules, tt.wantRules)
+			}
+			if !reflect.DeepEqual(probes, tt.wantProbes) {
+				t.Errorf("probes = %v, want %v", probes, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func TestAzureDelete(t *testing.T) {
+	fake := newFakeARM("shared-probe")
+	p := newFakeARMProvider(t, fake)
+
+	if err := p.Delete(context.Background(), &loadBalancerRef{Name: "api-fe", Address: "20.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !fake.updated {
+		t.Fatal("load balancer was not updated")
+	}
+	props := fake.lb["properties"].(map[string]any)
+	want := map[string][]string{
+		"frontendIPConfigurations": {"other-fe"},
+		"loadBalancingRules":       {"other-443"},
+		"probes":                   {"other-probe", "shared-probe"},
+		"inboundNatRules":          {"other-ssh"},
+		"outboundRules":            {"mixed-outbound"},
+	}
+	for key, wantNames := range want {
+		if got := names(props[key]); !reflect.DeepEqual(got, wantNames) {
+			t.Errorf("%s = %v, want %v", key, got, wantNames)
+		}
+	}
+	outbound := props["outboundRules"].([]any)[0].(map[string]any)["properties"].(map[string]any)
+	frontends := outbound["frontendIPConfigurations"].([]any)
+	if len(frontends) != 1 || !strings.HasSuffix(frontends[0].(map[string]any)["id"].(string), "/other-fe") {
+		t.Errorf("mixed-outbound frontends = %v, want only other-fe", frontends)
+	}
+
+	if !reflect.DeepEqual(fake.deleted, []string{"api-pip"}) {
+		t.Errorf("deleted public IPs = %v, want [api-pip]", fake.deleted)
+	}
+	if len(p.orphanPublicIPs) != 0 {
+		t.Errorf("orphan public IPs = %v, want none", p.orphanPublicIPs)
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	id := fakeAzureLBPath + "/frontendIPConfigurations/api-fe"
+	name := "named"
+	tests := []struct {
+		name     string
+		resName  *string
+		resID    *string
+		wantName string
+	}{
+		{name: "name", resName: &name, resID: &id, wantName: "named"},
+		{name: "fallback to ID", resID: &id, wantName: "api-fe"},
+		{name: "neither", wantName: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resourceName(tt.resName, tt.resID); got != tt.wantName {
+				t.Errorf("resourceName() = %q, want %q", got, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	computev1 "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// gcpLoadBalancerProvider manages the network load balancer of a service. GCP has no
+// single load balancer resource; it is made of a forwarding rule, backend service,
+// health check, target pool and address sharing the forwarding rule's name.
+type gcpLoadBalancerProvider struct {
+	svc     serviceLB
+	compute *computev1.Service
+	project string
+	region  string
+}
+
+func newGCPLoadBalancerProvider(ctx context.Context, svc serviceLB, region string) (*gcpLoadBalancerProvider, error) {
+	if region == "" {
+		return nil, fmt.Errorf("no GCP region given")
+	}
+
+	gcpCreds, ok := getGCPCreds(ctx)
+	if !ok {
+		return nil, fmt.Errorf("GCP creds not created")
+	}
+
+	computeService, err := computev1.NewService(ctx, option.WithCredentials(gcpCreds), option.WithScopes("https://www.googleapis.com/auth/compute"))
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize GCP compute service: %w", err)
+	}
+
+	return &gcpLoadBalancerProvider{svc: svc, compute: computeService, project: gcpCreds.ProjectID, region: region}, nil
+}
+
+func (p *gcpLoadBalancerProvider) Describe(ctx context.Context) (*loadBalancerRef, error) {
+	ip, err := p.svc.address(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ip == "" {
+		return nil, fmt.Errorf("service %s has no load balancer", p.svc.name)
+	}
+
+	rule, err := getGCPForwardingRuleForIP(p.compute, ip, p.project, p.region)
+	if err != nil {
+		return nil, fmt.Errorf("could not get forwarding rule for %s: %w", ip, err)
+	}
+	lb := &loadBalancerRef{Address: ip}
+	if rule != nil {
+		lb.Name = rule.Name
+	}
+	return lb, nil
+}
+
+// Delete deletes every GCP resource of the load balancer. Deleting only some of them
+// may leave the load balancer misconfigured instead of gone, so all are attempted.
+func (p *gcpLoadBalancerProvider) Delete(ctx context.Context, lb *loadBalancerRef) error {
+	var errs []error
+	if lb.Name == "" {
+		log.Printf("GCP forwarding rule for %s does not exist; Skipping deletion", p.svc.name)
+	} else {
+		if _, err := p.compute.ForwardingRules.Get(p.project, p.region, lb.Name).Do(); err != nil {
+			log.Printf("GCP forwarding rule %s not found", lb.Name)
+		} else if _, err := p.compute.ForwardingRules.Delete(p.project, p.region, lb.Name).Do(); err != nil {
+			errs = append(errs, fmt.Errorf("deleting forwarding rule %s: %w", lb.Name, err))
+		}
+
+		if _, err := p.compute.BackendServices.Get(p.project, lb.Name).Do(); err != nil {
+			log.Printf("GCP backend service %s already deleted", lb.Name)
+		} else if _, err := p.compute.BackendServices.Delete(p.project, lb.Name).Do(); err != nil {
+			errs = append(errs, fmt.Errorf("deleting backend service %s: %w", lb.Name, err))
+		}
+
+		if _, err := p.compute.HealthChecks.Get(p.project, lb.Name).Do(); err != nil {
+			log.Printf("GCP health check %s already deleted", lb.Name)
+		} else if _, err := p.compute.HealthChecks.Delete(p.project, lb.Name).Do(); err != nil {
+			errs = append(errs, fmt.Errorf("deleting health check %s: %w", lb.Name, err))
+		}
+
+		if _, err := p.compute.TargetPools.Get(p.project, p.region, lb.Name).Do(); err != nil {
+			log.Printf("GCP target pool %s already deleted", lb.Name)
+		} else if _, err := p.compute.TargetPools.Delete(p.project, p.region, lb.Name).Do(); err != nil {
+			errs = append(errs, fmt.Errorf("deleting target pool %s: %w", lb.Name, err))
+		}
+	}
+
+	if _, err := p.compute.Addresses.Get(p.project, p.region, lb.Address).Do(); err != nil {
+		log.Printf("GCP IP address %s already deleted", lb.Address)
+	} else if _, err := p.compute.Addresses.Delete(p.project, p.region, lb.Address).Do(); err != nil {
+		errs = append(errs, fmt.Errorf("deleting address %s: %w", lb.Address, err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// WaitRecreated waits for the service to get a new IP, then for GCP to create its
+// forwarding rule
+func (p *gcpLoadBalancerProvider) WaitRecreated(ctx context.Context, old *loadBalancerRef) (*loadBalancerRef, error) {
+	ip, err := p.svc.waitNewAddress(ctx, old.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var lb *loadBalancerRef
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 1*time.Minute, false, func(ctx context.Context) (bool, error) {
+		rule, err := getGCPForwardingRuleForIP(p.compute, ip, p.project, p.region)
+		if err != nil || rule == nil {
+			// Either we couldn't retrieve the LB, or it wasn't created yet
+			log.Printf("New forwarding rule not found yet...")
+			return false, nil
+		}
+		if rule.Name == old.Name {
+			// rh-api lb hasn't been deleted yet
+			log.Printf("Old forwarding rule not deleted yet...")
+			return false, nil
+		}
+		lb = &loadBalancerRef{Name: rule.Name, Address: ip}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new forwarding rule for %s not created in GCP: %w", ip, err)
+	}
+	return lb, nil
+}
+
+// CleanupOrphans is a no-op: Delete already removes every resource of the load balancer,
+// including its address
+func (p *gcpLoadBalancerProvider) CleanupOrphans(ctx context.Context) error {
+	return nil
+}
+
+// get credential object to use in service initialization
+func getGCPCreds(ctx context.Context) (*google.Credentials, bool) {
+	serviceAccountJSON := []byte(os.Getenv("GCP_CREDS_JSON"))
+	credentials, err := google.CredentialsFromJSON(
+		ctx, serviceAccountJSON,
+		computev1.ComputeScope)
+	if err != nil {
+		return nil, false
+	}
+	return credentials, true
+}
+
+// Get forwarding rule for rh-api load balancer in GCP
+func getGCPForwardingRuleForIP(computeService *computev1.Service, oldLBIP string, project string, region string) (*computev1.ForwardingRule, error) {
+	listCall := computeService.ForwardingRules.List(project, region)
+	response, err := listCall.Do()
+	var oldLB *computev1.ForwardingRule
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lb := range response.Items {
+		// This list of forwardingrules (LBs) includes any service LBs
+		// for application routers so check the IP to identify
+		// the rh-api LB.
+		if lb.IPAddress == oldLBIP {
+			oldLB = lb
+		}
+	}
+
+	return oldLB, nil
+}
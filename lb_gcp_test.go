@@ -0,0 +1,196 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	computev1 "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+const fakeGCPPrefix = "/compute/v1/projects/proj/"
+
+// fakeCompute serves the compute resources of one project, keyed by their path below the
+// project, e.g. regions/us-east1/forwardingRules/a1b2, recording deletions
+type fakeCompute struct {
+	mu        sync.Mutex
+	resources map[string]map[string]any
+	failing   map[string]bool // resources whose deletion fails
+	deleted   []string
+	requests  int
+}
+
+func (f *fakeCompute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	path := strings.TrimPrefix(r.URL.Path, fakeGCPPrefix)
+	var body any
+	switch {
+	case r.Method == http.MethodGet && path == "regions/us-east1/forwardingRules":
+		var items []map[string]any
+		for key, resource := range f.resources {
+			if strings.HasPrefix(key, path+"/") {
+				items = append(items, resource)
+			}
+		}
+		body = map[string]any{"items": items}
+	case r.Method == http.MethodGet && f.resources[path] != nil:
+		body = f.resources[path]
+	case r.Method == http.MethodDelete && f.failing[path]:
+		http.Error(w, `{"error":{"code":500,"message":"backend error"}}`, http.StatusInternalServerError)
+		return
+	case r.Method == http.MethodDelete && f.resources[path] != nil:
+		delete(f.resources, path)
+		f.deleted = append(f.deleted, path)
+		body = map[string]any{"name": "operation-delete", "status": "RUNNING"}
+	default:
+		http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// newFakeComputeProvider returns a GCP provider in region us-east1 of project proj sending
+// its requests to fake, for a service whose load balancer has the given address
+func newFakeComputeProvider(t *testing.T, fake *fakeCompute, address string) *gcpLoadBalancerProvider {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	compute, err := computev1.NewService(context.Background(), option.WithEndpoint(srv.URL+"/compute/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := serviceLB{name: "rh-api", lookup: func(ctx context.Context) (string, error) { return address, nil }}
+	return &gcpLoadBalancerProvider{svc: svc, compute: compute, project: "proj", region: "us-east1"}
+}
+
+// newFakeCompute returns the forwarding rule and target pool of the rh-api load balancer
+// a1b2 at 34.0.0.1, next to the forwarding rule of another service
+func newFakeCompute() *fakeCompute {
+	return &fakeCompute{
+		resources: map[string]map[string]any{
+			"regions/us-east1/forwardingRules/a1b2": {"name": "a1b2", "IPAddress": "34.0.0.1"},
+			"regions/us-east1/forwardingRules/c3d4": {"name": "c3d4", "IPAddress": "34.0.0.2"},
+			"regions/us-east1/targetPools/a1b2":     {"name": "a1b2"},
+		},
+		failing: map[string]bool{},
+	}
+}
+
+func TestGCPDescribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "forwarding rule of the address", address: "34.0.0.1", wantName: "a1b2"},
+		{name: "no forwarding rule yet", address: "34.0.0.9", wantName: ""},
+		{name: "no load balancer", address: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeComputeProvider(t, newFakeCompute(), tt.address)
+			lb, err := p.Describe(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Describe() = %v, want error", lb)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lb.Name != tt.wantName || lb.Address != tt.address {
+				t.Errorf("Describe() = %q (%s), want %q (%s)", lb.Name, lb.Address, tt.wantName, tt.address)
+			}
+		})
+	}
+}
+
+func TestGCPDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		lb          *loadBalancerRef
+		failing     string
+		wantDeleted []string
+		wantErr     string
+	}{
+		{
+			name: "forwarding rule and target pool",
+			lb:   &loadBalancerRef{Name: "a1b2", Address: "34.0.0.1"},
+			wantDeleted: []string{
+				"regions/us-east1/forwardingRules/a1b2",
+				"regions/us-east1/targetPools/a1b2",
+			},
+		},
+		{
+			name:    "target pool deletion fails after the forwarding rule",
+			lb:      &loadBalancerRef{Name: "a1b2", Address: "34.0.0.1"},
+			failing: "regions/us-east1/targetPools/a1b2",
+			wantDeleted: []string{
+				"regions/us-east1/forwardingRules/a1b2",
+			},
+			wantErr: "deleting target pool a1b2",
+		},
+		{
+			name:    "forwarding rule deletion fails, target pool is still deleted",
+			lb:      &loadBalancerRef{Name: "a1b2", Address: "34.0.0.1"},
+			failing: "regions/us-east1/forwardingRules/a1b2",
+			wantDeleted: []string{
+				"regions/us-east1/targetPools/a1b2",
+			},
+			wantErr: "deleting forwarding rule a1b2",
+		},
+		{name: "already deleted", lb: &loadBalancerRef{Name: "e5f6", Address: "34.0.0.5"}},
+		{name: "no forwarding rule", lb: &loadBalancerRef{Address: "34.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeCompute()
+			if tt.failing != "" {
+				fake.failing[tt.failing] = true
+			}
+			p := newFakeComputeProvider(t, fake, tt.lb.Address)
+
+			err := p.Delete(context.Background(), tt.lb)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Delete() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(fake.deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", fake.deleted, tt.wantDeleted)
+			}
+			if fake.resources["regions/us-east1/forwardingRules/c3d4"] == nil {
+				t.Error("deleted the forwarding rule of another service")
+			}
+		})
+	}
+}
+
+func TestGCPCleanupOrphans(t *testing.T) {
+	fake := newFakeCompute()
+	p := newFakeComputeProvider(t, fake, "34.0.0.1")
+	if err := p.CleanupOrphans(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests != 0 {
+		t.Errorf("CleanupOrphans() sent %d requests, want none as Delete removes everything", fake.requests)
+	}
+}
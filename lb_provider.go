@@ -0,0 +1,101 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/openshift/osde2e-common/pkg/clients/openshift"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// errUnsupportedProvider is returned for clouds without a LoadBalancerProvider
+var errUnsupportedProvider = errors.New("unsupported cloud provider")
+
+// loadBalancerRef identifies the cloud load balancer of a service
+type loadBalancerRef struct {
+	Name    string // cloud resource name, e.g. the ELB name or GCP forwarding rule name
+	Type    string // kind of load balancer where a cloud has several, e.g. classic or network on AWS
+	Address string // hostname or IP the service exposes
+	ARN     string // AWS only: the load balancer ARN, as names are only unique per type
+}
+
+func (lb *loadBalancerRef) String() string {
+	if lb.Type != "" {
+		return fmt.Sprintf("%s %s (%s)", lb.Type, lb.Name, lb.Address)
+	}
+	return fmt.Sprintf("%s (%s)", lb.Name, lb.Address)
+}
+
+// LoadBalancerProvider manages the cloud load balancer of a LoadBalancer service, so the
+// recreation spec can run on any cloud that implements it
+type LoadBalancerProvider interface {
+	// Describe returns the load balancer currently serving the service
+	Describe(ctx context.Context) (*loadBalancerRef, error)
+	// Delete deletes lb and the cloud resources making it up, as an admin would manually
+	Delete(ctx context.Context, lb *loadBalancerRef) error
+	// WaitRecreated waits until the operator has replaced old with a new load balancer
+	WaitRecreated(ctx context.Context, old *loadBalancerRef) (*loadBalancerRef, error)
+	// CleanupOrphans deletes resources the deleted load balancer left behind
+	CleanupOrphans(ctx context.Context) error
+}
+
+// newLoadBalancerProvider returns the LoadBalancerProvider of the cluster's cloud for the
+// given service
+func newLoadBalancerProvider(ctx context.Context, k8s *openshift.Client, provider, region, namespace, service string) (LoadBalancerProvider, error) {
+	svc := serviceLB{k8s: k8s, namespace: namespace, name: service}
+	switch provider {
+	case "aws":
+		return newAWSLoadBalancerProvider(ctx, svc, region)
+	case "gcp":
+		return newGCPLoadBalancerProvider(ctx, svc, region)
+	case "azure":
+		return newAzureLoadBalancerProvider(svc)
+	}
+	return nil, fmt.Errorf("%w %q", errUnsupportedProvider, provider)
+}
+
+// serviceLB reads the load balancer address of a service, shared by all providers
+type serviceLB struct {
+	k8s       *openshift.Client
+	namespace string
+	name      string
+	// lookup replaces reading the service from the cluster, for tests
+	lookup func(ctx context.Context) (string, error)
+}
+
+// address returns the IP or hostname of the service load balancer, or an empty string if
+// it wasn't created yet
+func (s serviceLB) address(ctx context.Context) (string, error) {
+	if s.lookup != nil {
+		return s.lookup(ctx)
+	}
+	return getLBForService(ctx, s.k8s, s.namespace, s.name)
+}
+
+// waitNewAddress waits for the operator to reconcile the service with a load balancer
+// address other than old, and returns it
+func (s serviceLB) waitNewAddress(ctx context.Context, old string) (string, error) {
+	var address string
+	err := wait.PollUntilContextTimeout(ctx, 15*time.Second, 10*time.Minute, true, func(ctx context.Context) (bool, error) {
+		var err error
+		address, err = s.address(ctx)
+		if err != nil || address == "" {
+			// either we couldn't retrieve the address, or the LB wasn't created yet
+			log.Printf("New %s load balancer not found yet...", s.name)
+			return false, nil
+		}
+		if address == old {
+			log.Printf("Old %s load balancer not deleted yet...", s.name)
+			return false, nil
+		}
+		return true, nil
+	})
+	return address, err
+}
@@ -0,0 +1,20 @@
+// DO NOT REMOVE TAGS BELOW. IF ANY NEW TEST FILES ARE CREATED UNDER /osde2e, PLEASE ADD THESE TAGS TO THEM IN ORDER TO BE EXCLUDED FROM UNIT TESTS. //go:build osde2e
+//go:build osde2e
+// +build osde2e
+
+package osde2etests
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewLoadBalancerProviderUnsupported(t *testing.T) {
+	for _, provider := range []string{"", "ibmcloud", "GCP"} {
+		p, err := newLoadBalancerProvider(context.Background(), nil, provider, "us-east1", "openshift-kube-apiserver", "rh-api")
+		if !errors.Is(err, errUnsupportedProvider) {
+			t.Errorf("newLoadBalancerProvider(%q) = %v, %v, want %v", provider, p, err, errUnsupportedProvider)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Replacement for secrets in log output
+const redacted = "[REDACTED]"
+
+// Environment variables whose values must never be logged
+var secretEnvVars = []string{"GITHUB_TOKEN", "CODECOV_TOKEN", "COVERALLS_TOKEN", "SONAR_TOKEN"}
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// Patterns for credentials that may show up in URLs, headers and response bodies
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// query parameters such as ?token=... or &repo_token=...
+	{regexp.MustCompile(`(?i)([?&](?:token|access_token|repo_token|upload_token|api_key|apikey|key|secret|password)=)[^&\s"'<>]+`), "${1}" + redacted},
+	// Authorization headers and their values dumped as text
+	{regexp.MustCompile(`(?i)(authorization"?:?\s*\[?"?(?:bearer|token|basic)\s+)[^\s"'\]]+`), "${1}" + redacted},
+	// JSON fields holding credentials
+	{regexp.MustCompile(`(?i)("(?:token|access_token|repo_token|upload_token|api_key|secret|password)"\s*:\s*")[^"]*"`), "${1}" + redacted + `"`},
+	// GitHub token formats
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`), redacted},
+}
+
+// Headers whose values are always redacted
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// registerSecret adds values that are redacted wherever they appear in log output
+func registerSecret(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, v := range values {
+		// very short values would redact unrelated text
+		if len(v) >= 6 {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// redact removes registered secrets and anything that looks like a credential from s
+func redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	secretsMu.RUnlock()
+
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// redactHeaders returns a copy of h that is safe to log
+func redactHeaders(h http.Header) http.Header {
+	clean := make(http.Header, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			clean.Add(name, redact(v))
+		}
+	}
+	for _, name := range secretHeaders {
+		if clean.Get(name) != "" {
+			clean.Set(name, redacted)
+		}
+	}
+	return clean
+}
+
+// redactValue redacts a log attribute value, recursing into groups
+func redactValue(v slog.Value) slog.Value {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(redact(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		clean := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			clean[i] = slog.Attr{Key: a.Key, Value: redactValue(a.Value)}
+		}
+		return slog.GroupValue(clean...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case http.Header:
+			return slog.AnyValue(redactHeaders(x))
+		case *url.URL:
+			return slog.StringValue(redact(x.String()))
+		case error:
+			return slog.StringValue(redact(x.Error()))
+		case fmt.Stringer:
+			return slog.StringValue(redact(x.String()))
+		case []byte:
+			return slog.StringValue(redact(string(x)))
+		default:
+			return slog.StringValue(redact(fmt.Sprintf("%+v", x)))
+		}
+	}
+	return v
+}
+
+// redactingHandler redacts secrets from messages and attributes before passing
+// records on to the next handler
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(slog.Attr{Key: a.Key, Value: redactValue(a.Value)})
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = slog.Attr{Key: a.Key, Value: redactValue(a.Value)}
+	}
+	return &redactingHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// logOptions are the logging flags shared by every command
+type logOptions struct {
+	level  string
+	format string
+}
+
+// addLogFlags registers the logging flags on fs
+func addLogFlags(fs *flag.FlagSet) *logOptions {
+	opts := &logOptions{}
+	fs.StringVar(&opts.level, "log-level", "info", "Log level: debug, info, warn or error")
+	fs.StringVar(&opts.format, "log-format", "text", "Log format: text or json")
+	return opts
+}
+
+// setup installs a redacting slog logger on stderr as the default logger. The log
+// package is routed through it as well, so log.Fatal output is redacted too.
+func (o *logOptions) setup() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.level)); err != nil {
+		return fmt.Errorf("invalid -log-level %q", o.level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch o.format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return fmt.Errorf("invalid -log-format %q, want text or json", o.format)
+	}
+
+	for _, name := range secretEnvVars {
+		registerSecret(os.Getenv(name))
+	}
+
+	slog.SetDefault(slog.New(&redactingHandler{next: handler}))
+	// only log.Fatal goes through the log package, so it must survive -log-level error
+	slog.SetLogLoggerLevel(slog.LevelError)
+	return nil
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// Paths where Codecov looks for its config
+var codecovConfigPaths = []string{"codecov.yml", ".codecov.yml", "codecov.yaml", ".codecov.yaml", ".github/codecov.yml", ".github/.codecov.yml"}
+
+// Files added by onboarding PRs
+const (
+	onboardCodecovPath  = "codecov.yml"
+	onboardWorkflowPath = ".github/workflows/coverage.yml"
+)
+
+// Built-in templates, overridable per org with -templates-dir. They use [[ ]] delimiters
+// so that GitHub Actions ${{ }} expressions can be written as is.
+const defaultCodecovTemplate = `coverage:
+  status:
+    project:
+      default:
+        target: auto
+        threshold: 1%
+    patch:
+      default:
+        target: auto
+comment:
+  layout: "reach, diff, files"
+ignore:
+  - "vendor/**"
+  - "**/zz_generated*.go"
+  - "**/*.pb.go"
+`
+
+const defaultWorkflowTemplate = `name: coverage
+on:
+  push:
+    branches: [ [[ .Branch ]] ]
+  pull_request:
+    branches: [ [[ .Branch ]] ]
+jobs:
+  coverage:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version-file: go.mod
+      - name: Run tests with coverage
+        run: go test -coverprofile=coverage.out -covermode=atomic ./...
+      - name: Upload coverage to Codecov
+        uses: codecov/codecov-action@v4
+        with:
+          files: coverage.out
+          token: ${{ secrets.CODECOV_TOKEN }}
+`
+
+// templateData is passed to the onboarding templates
+type templateData struct {
+	Org    string
+	Repo   string
+	Branch string
+}
+
+// onboardFile is a file an onboarding PR adds
+type onboardFile struct {
+	Path    string
+	Content []byte
+}
+
+// runOnboard implements the "onboard" command, which opens PRs adding a codecov.yml
+// and a coverage upload workflow to Go repos that are not configured with Codecov
+func runOnboard(args []string) int {
+	fs := flag.NewFlagSet("onboard", flag.ExitOnError)
+	targetOpts := addTargetFlags(fs)
+	collect := addCollectFlags(fs)
+	templatesDir := fs.String("templates-dir", "", "Directory with codecov.yml and coverage.yml templates, overridden per org in <dir>/<org>/")
+	headBranch := fs.String("pr-branch", "add-codecov", "Branch to push the onboarding changes to")
+	dryRun := fs.Bool("dry-run", false, "Write the patches to -patch-dir instead of opening PRs")
+	patchDir := fs.String("patch-dir", "onboarding-patches", "Directory for dry-run patches")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	// only Codecov can be onboarded
+	if collect.provider != "codecov" {
+		log.Fatalf("❌ onboarding is only available for codecov, not %s", collect.provider)
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+	providers, err := collect.providers()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	ctx := context.Background()
+	ghClient := newGitHubClient(githubToken)
+	targets, err := targetOpts.resolve(ctx, ghClient)
+	if err != nil {
+		log.Fatalf("❌ Error getting repositories: %v", err)
+	}
+
+	// Only Go repos that Codecov does not know can be onboarded with the Go workflow
+	var goTargets []repoTarget
+	for _, target := range targets {
+		if target.Repo != nil && target.Repo.GetLanguage() == "Go" && !target.Repo.GetArchived() {
+			goTargets = append(goTargets, target)
+		}
+	}
+	results := collectCoverage(nil, goTargets, providers, false, collect.concurrency)
+
+	exitCode := exitOK
+	for i, result := range results {
+		if result.Coverage.Status != StatusNotConfigured {
+			continue
+		}
+		target := goTargets[i]
+
+		files, err := onboardingFiles(ctx, ghClient, target, *templatesDir)
+		if err != nil {
+			slog.Error("Error preparing onboarding", "repo", target.FullName(), "error", err)
+			exitCode = exitAPIErrors
+			continue
+		}
+		if len(files) == 0 {
+			slog.Info("Repository already has Codecov config and upload, skipping", "repo", target.FullName())
+			continue
+		}
+
+		if *dryRun {
+			filename, err := writeOnboardingPatch(*patchDir, target, files)
+			if err != nil {
+				slog.Error("Error writing patch", "repo", target.FullName(), "error", err)
+				exitCode = exitAPIErrors
+				continue
+			}
+			slog.Info("Onboarding patch written", "repo", target.FullName(), "file", filename)
+			continue
+		}
+
+		url, err := openOnboardingPR(ctx, ghClient, target, *headBranch, files)
+		if err != nil {
+			slog.Error("Error opening onboarding PR", "repo", target.FullName(), "error", err)
+			exitCode = exitAPIErrors
+			continue
+		}
+		if url == "" {
+			slog.Info("Onboarding PR already open, skipping", "repo", target.FullName(), "branch", *headBranch)
+			continue
+		}
+		slog.Info("Onboarding PR opened", "repo", target.FullName(), "url", url)
+	}
+	return exitCode
+}
+
+// onboardingFiles inspects the repo through the contents API and returns the files
+// still missing: a codecov.yml unless one exists, and a workflow unless one already
+// uploads to Codecov
+func onboardingFiles(ctx context.Context, ghClient *github.Client, target repoTarget, templatesDir string) ([]onboardFile, error) {
+	data := templateData{Org: target.Org, Repo: target.Name, Branch: target.Branch}
+	var files []onboardFile
+
+	hasConfig := false
+	for _, path := range codecovConfigPaths {
+		file, _, err := getContents(ctx, ghClient, target, path)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			hasConfig = true
+			break
+		}
+	}
+	if !hasConfig {
+		content, err := renderTemplate(templatesDir, target.Org, "codecov.yml", defaultCodecovTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, onboardFile{Path: onboardCodecovPath, Content: content})
+	}
+
+	uploads, err := workflowsUploadCoverage(ctx, ghClient, target)
+	if err != nil {
+		return nil, err
+	}
+	if !uploads {
+		content, err := renderTemplate(templatesDir, target.Org, "coverage.yml", defaultWorkflowTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, onboardFile{Path: onboardWorkflowPath, Content: content})
+	}
+
+	return files, nil
+}
+
+// workflowsUploadCoverage reports whether any GitHub Actions workflow mentions Codecov
+func workflowsUploadCoverage(ctx context.Context, ghClient *github.Client, target repoTarget) (bool, error) {
+	_, dir, err := getContents(ctx, ghClient, target, ".github/workflows")
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range dir {
+		if entry.GetType() != "file" {
+			continue
+		}
+		file, _, err := getContents(ctx, ghClient, target, entry.GetPath())
+		if err != nil {
+			return false, err
+		}
+		if file == nil {
+			continue
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return false, err
+		}
+		if strings.Contains(strings.ToLower(content), "codecov") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getContents fetches a file or directory on the target branch; both are nil if the path doesn't exist
+func getContents(ctx context.Context, ghClient *github.Client, target repoTarget, path string) (*github.RepositoryContent, []*github.RepositoryContent, error) {
+	var file *github.RepositoryContent
+	var dir []*github.RepositoryContent
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		file, dir, resp, err = ghClient.Repositories.GetContents(ctx, target.Org, target.Name, path, &github.RepositoryContentGetOptions{Ref: target.Branch})
+		return resp, err
+	})
+	if isNotFound(err) {
+		return nil, nil, nil
+	}
+	return file, dir, err
+}
+
+// isNotFound reports whether err is a GitHub 404
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// renderTemplate renders the org's override of name from templatesDir, falling back to
+// the shared override and then to the built-in template
+func renderTemplate(templatesDir, org, name, builtin string, data templateData) ([]byte, error) {
+	text := builtin
+	if templatesDir != "" {
+		for _, path := range []string{filepath.Join(templatesDir, org, name), filepath.Join(templatesDir, name)} {
+			content, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			text = string(content)
+			break
+		}
+	}
+
+	tmpl, err := template.New(name).Delims("[[", "]]").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering template %s: %v", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeOnboardingPatch writes the files as a patch that git apply can add to the repo
+func writeOnboardingPatch(dir string, target repoTarget, files []onboardFile) (string, error) {
+	var patch bytes.Buffer
+	for _, file := range files {
+		lines := strings.SplitAfter(string(file.Content), "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\nnew file mode 100644\n--- /dev/null\n+++ b/%s\n@@ -0,0 +1,%d @@\n",
+			file.Path, file.Path, file.Path, len(lines))
+		for _, line := range lines {
+			patch.WriteString("+" + line)
+			if !strings.HasSuffix(line, "\n") {
+				patch.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, target.Org), 0o755); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, target.Org, target.Name+".patch")
+	return filename, os.WriteFile(filename, patch.Bytes(), 0o644)
+}
+
+// openOnboardingPR pushes the files to the onboarding branch and opens a PR against the
+// target branch. It returns an empty URL without changes if a PR from the branch is
+// already open, so re-runs don't open duplicate PRs. A branch left by an interrupted run
+// is reused, adding the files it misses.
+func openOnboardingPR(ctx context.Context, ghClient *github.Client, target repoTarget, branch string, files []onboardFile) (string, error) {
+	pr, err := findOnboardingPR(ctx, ghClient, target, branch)
+	if err != nil {
+		return "", err
+	}
+	if pr != nil {
+		return "", nil
+	}
+
+	exists, err := branchExists(ctx, ghClient, target, branch)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		base := headSHA(ctx, ghClient, target)
+		if base == "" {
+			return "", fmt.Errorf("branch HEAD of %s is unknown", target.FullName())
+		}
+		err = withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := ghClient.Git.CreateRef(ctx, target.Org, target.Name, &github.Reference{
+				Ref:    github.String("refs/heads/" + branch),
+				Object: &github.GitObject{SHA: github.String(base)},
+			})
+			return resp, err
+		}, func() (bool, error) {
+			return branchExists(ctx, ghClient, target, branch)
+		})
+		if err != nil {
+			return "", fmt.Errorf("error creating branch %s: %v", branch, err)
+		}
+	}
+
+	onBranch := target
+	onBranch.Branch = branch
+	var paths []string
+	for _, file := range files {
+		file := file
+		paths = append(paths, "`"+file.Path+"`")
+		fileExists := func() (bool, error) {
+			existing, _, err := getContents(ctx, ghClient, onBranch, file.Path)
+			return existing != nil, err
+		}
+		// committed by an interrupted run
+		exists, err := fileExists()
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			continue
+		}
+
+		err = withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := ghClient.Repositories.CreateFile(ctx, target.Org, target.Name, file.Path, &github.RepositoryContentFileOptions{
+				Message: github.String("Add " + file.Path + " for Codecov coverage reports"),
+				Content: file.Content,
+				Branch:  github.String(branch),
+			})
+			return resp, err
+		}, fileExists)
+		if err != nil {
+			return "", fmt.Errorf("error adding %s: %v", file.Path, err)
+		}
+	}
+
+	body := fmt.Sprintf("This repository does not report test coverage to Codecov yet.\n\n"+
+		"This PR adds %s so coverage of `%s` is uploaded on every push and pull request. "+
+		"A `CODECOV_TOKEN` repository secret may be needed for the upload.\n", strings.Join(paths, " and "), target.Branch)
+
+	err = withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		pr, resp, err = ghClient.PullRequests.Create(ctx, target.Org, target.Name, &github.NewPullRequest{
+			Title: github.String("Report test coverage to Codecov"),
+			Head:  github.String(branch),
+			Base:  github.String(target.Branch),
+			Body:  github.String(body),
+		})
+		return resp, err
+	}, func() (bool, error) {
+		var err error
+		pr, err = findOnboardingPR(ctx, ghClient, target, branch)
+		return pr != nil, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error opening PR: %v", err)
+	}
+	return pr.GetHTMLURL(), nil
+}
+
+// findOnboardingPR returns the open PR from branch, if any
+func findOnboardingPR(ctx context.Context, ghClient *github.Client, target repoTarget, branch string) (*github.PullRequest, error) {
+	var pulls []*github.PullRequest
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		pulls, resp, err = ghClient.PullRequests.List(ctx, target.Org, target.Name, &github.PullRequestListOptions{
+			State: "open",
+			Head:  target.Org + ":" + branch,
+		})
+		return resp, err
+	})
+	if err != nil || len(pulls) == 0 {
+		return nil, err
+	}
+	return pulls[0], nil
+}
+
+// branchExists reports whether the repo has the given branch
+func branchExists(ctx context.Context, ghClient *github.Client, target repoTarget, branch string) (bool, error) {
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		_, resp, err := ghClient.Git.GetRef(ctx, target.Org, target.Name, "heads/"+branch)
+		return resp, err
+	})
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOnboardingRepo serves the GitHub endpoints used to open an onboarding PR
+type fakeOnboardingRepo struct {
+	mu     sync.Mutex
+	branch bool
+	files  map[string]bool // files committed to the branch
+	prOpen bool
+	writes []string
+}
+
+func (f *fakeOnboardingRepo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const repo = "/repos/myorg/myrepo"
+	path := strings.TrimPrefix(r.URL.Path, repo)
+	if r.Method != http.MethodGet {
+		f.writes = append(f.writes, r.Method+" "+path)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "/pulls":
+		if r.URL.Query().Get("head") != "myorg:add-codecov" {
+			http.Error(w, "unexpected head "+r.URL.Query().Get("head"), http.StatusBadRequest)
+			return
+		}
+		if f.prOpen {
+			w.Write([]byte(`[{"number": 1, "html_url": "https://github.com/myorg/myrepo/pull/1"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	case r.Method == http.MethodPost && path == "/pulls":
+		f.prOpen = true
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 2, "html_url": "https://github.com/myorg/myrepo/pull/2"}`))
+	case r.Method == http.MethodGet && path == "/git/ref/heads/add-codecov":
+		if !f.branch {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ref": "refs/heads/add-codecov"}`))
+	case r.Method == http.MethodPost && path == "/git/refs":
+		f.branch = true
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ref": "refs/heads/add-codecov"}`))
+	case r.Method == http.MethodGet && path == "/commits/main":
+		w.Write([]byte("basesha"))
+	case strings.HasPrefix(path, "/contents/"):
+		file := strings.TrimPrefix(path, "/contents/")
+		if r.Method == http.MethodPut {
+			f.files[file] = true
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+			return
+		}
+		if r.URL.Query().Get("ref") != "add-codecov" || !f.files[file] {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"type": "file", "path": file})
+	default:
+		http.Error(w, "unexpected request", http.StatusNotFound)
+	}
+}
+
+func TestOpenOnboardingPR(t *testing.T) {
+	files := []onboardFile{
+		{Path: onboardCodecovPath, Content: []byte("coverage: {}\n")},
+		{Path: onboardWorkflowPath, Content: []byte("on: push\n")},
+	}
+
+	tests := []struct {
+		name       string
+		repo       *fakeOnboardingRepo
+		wantURL    string
+		wantWrites []string
+	}{
+		{
+			name:    "fresh repo",
+			repo:    &fakeOnboardingRepo{files: map[string]bool{}},
+			wantURL: "https://github.com/myorg/myrepo/pull/2",
+			wantWrites: []string{
+				"POST /git/refs",
+				"PUT /contents/" + onboardCodecovPath,
+				"PUT /contents/" + onboardWorkflowPath,
+				"POST /pulls",
+			},
+		},
+		{
+			name:    "branch left by an interrupted run",
+			repo:    &fakeOnboardingRepo{branch: true, files: map[string]bool{onboardCodecovPath: true}},
+			wantURL: "https://github.com/myorg/myrepo/pull/2",
+			wantWrites: []string{
+				"PUT /contents/" + onboardWorkflowPath,
+				"POST /pulls",
+			},
+		},
+		{
+			name: "pr already open",
+			repo: &fakeOnboardingRepo{branch: true, files: map[string]bool{onboardCodecovPath: true, onboardWorkflowPath: true}, prOpen: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := repoTarget{Org: "myorg", Name: "myrepo", Branch: "main"}
+			url, err := openOnboardingPR(context.Background(), newTestGitHubClient(t, tt.repo), target, "add-codecov", files)
+			if err != nil {
+				t.Fatalf("openOnboardingPR: %v", err)
+			}
+			if url != tt.wantURL || !reflect.DeepEqual(tt.repo.writes, tt.wantWrites) {
+				t.Errorf("openOnboardingPR() = %q with writes %q, want %q with %q", url, tt.repo.writes, tt.wantURL, tt.wantWrites)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy sets minimum coverage for repos and files. Example:
+//
+//	default: 40
+//	require_coverage: false
+//	repos:
+//	  - match: cloud-ingress-operator
+//	    min: 70
+//	  - match: "*-operator"
+//	    min: 60
+//	files:
+//	  - repo: "*-operator"
+//	    path: "pkg/controller/**"
+//	    min: 50
+//
+// The first matching repo rule wins, falling back to default. The first matching
+// file rule applies to each file.
+type Policy struct {
+	// Default is the minimum coverage for repos without a matching rule; 0 disables it
+	Default float64 `yaml:"default"`
+	// RequireCoverage makes repos with a minimum but no coverage number violations
+	RequireCoverage bool       `yaml:"require_coverage"`
+	Repos           []RepoRule `yaml:"repos"`
+	Files           []FileRule `yaml:"files"`
+}
+
+// RepoRule sets the minimum coverage for repos whose name matches a glob
+type RepoRule struct {
+	Match string  `yaml:"match"`
+	Min   float64 `yaml:"min"`
+
+	match *glob
+}
+
+// FileRule sets the minimum coverage for files matching a path glob, optionally
+// only in repos matching Repo
+type FileRule struct {
+	Repo string  `yaml:"repo"`
+	Path string  `yaml:"path"`
+	Min  float64 `yaml:"min"`
+
+	repo *glob // nil to match every repo
+	path *glob
+}
+
+// Violation is a repo or file below its minimum coverage
+type Violation struct {
+	Repo     string
+	File     string // empty for repo-level violations
+	Coverage float64
+	Min      float64
+	Reason   string
+}
+
+func (v Violation) String() string {
+	if v.File != "" {
+		return fmt.Sprintf("%s: %s has %.2f%% coverage, policy requires %.2f%%", v.Repo, v.File, v.Coverage, v.Min)
+	}
+	if v.Reason != "" {
+		return fmt.Sprintf("%s: %s, policy requires %.2f%%", v.Repo, v.Reason, v.Min)
+	}
+	return fmt.Sprintf("%s: has %.2f%% coverage, policy requires %.2f%%", v.Repo, v.Coverage, v.Min)
+}
+
+// loadPolicy reads and validates a YAML policy file
+func loadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy %s: %v", filename, err)
+	}
+
+	// compile the globs once, rules are matched against every repo and file
+	for i := range policy.Repos {
+		rule := &policy.Repos[i]
+		if rule.Match == "" {
+			return nil, fmt.Errorf("policy %s: repo rule without match", filename)
+		}
+		rule.match = compileGlob(rule.Match)
+	}
+	for i := range policy.Files {
+		rule := &policy.Files[i]
+		if rule.Path == "" {
+			return nil, fmt.Errorf("policy %s: file rule without path", filename)
+		}
+		if rule.Repo != "" {
+			rule.repo = compileGlob(rule.Repo)
+		}
+		rule.path = compileGlob(rule.Path)
+	}
+	return &policy, nil
+}
+
+// NeedsFiles reports whether evaluating the policy requires detailed reports
+func (p *Policy) NeedsFiles() bool {
+	return len(p.Files) > 0
+}
+
+// repoMin returns the minimum coverage for repo, and false if no rule applies
+func (p *Policy) repoMin(repo RepoCoverage) (float64, bool) {
+	for _, rule := range p.Repos {
+		if matchRepo(rule.match, repo) {
+			return rule.Min, true
+		}
+	}
+	return p.Default, p.Default > 0
+}
+
+// fileMin returns the minimum coverage for a file in repo, and false if no rule applies
+func (p *Policy) fileMin(repo RepoCoverage, file string) (float64, bool) {
+	for _, rule := range p.Files {
+		if (rule.repo == nil || matchRepo(rule.repo, repo)) && rule.path.Match(file) {
+			return rule.Min, true
+		}
+	}
+	return 0, false
+}
+
+// Evaluate checks every result against the policy. Repos whose coverage could not
+// be fetched are skipped; they are reported as API errors instead.
+func (p *Policy) Evaluate(results []repoResult) []Violation {
+	var violations []Violation
+	for _, result := range results {
+		repo := result.Coverage
+		if repo.Status.IsError() {
+			continue
+		}
+
+		if min, ok := p.repoMin(repo); ok {
+			if !repo.Status.HasCoverage() {
+				if p.RequireCoverage {
+					violations = append(violations, Violation{Repo: repo.FullName(), Min: min, Reason: strings.ToLower(repo.Status.String())})
+				}
+			} else if repo.Coverage < min {
+				violations = append(violations, Violation{Repo: repo.FullName(), Coverage: repo.Coverage, Min: min})
+			}
+		}
+
+		if result.Report == nil {
+			continue
+		}
+		for _, file := range result.Report.Files {
+			if min, ok := p.fileMin(repo, file.Name); ok && file.Totals.Coverage < min {
+				violations = append(violations, Violation{Repo: repo.FullName(), File: file.Name, Coverage: file.Totals.Coverage, Min: min})
+			}
+		}
+	}
+	return violations
+}
+
+// writeViolations prints a violation report
+func writeViolations(w io.Writer, violations []Violation) {
+	fmt.Fprintf(w, "❌ %d coverage policy violations:\n", len(violations))
+	for _, v := range violations {
+		fmt.Fprintf(w, "  - %s\n", v)
+	}
+}
+
+// matchRepo matches a repo glob against either the "org/repo" or the bare repo name
+func matchRepo(g *glob, repo RepoCoverage) bool {
+	return g.Match(repo.FullName()) || g.Match(repo.Name)
+}
+
+// glob is a compiled pattern where * and ? do not cross "/" and ** does
+type glob struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// compileGlob compiles pattern; every pattern is valid
+func compileGlob(pattern string) *glob {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return &glob{pattern: pattern, re: regexp.MustCompile(re.String())}
+}
+
+// Match reports whether name matches the glob
+func (g *glob) Match(name string) bool {
+	return g.re.MatchString(name)
+}
+
+func (g *glob) String() string {
+	return g.pattern
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"cloud-ingress-operator", "cloud-ingress-operator", true},
+		{"cloud-ingress-operator", "cloud-ingress-operator-v2", false},
+		{"*-operator", "ocm-agent-operator", true},
+		{"*-operator", "openshift/ocm-agent-operator", false},
+		{"openshift/*", "openshift/ocm-agent", true},
+		{"repo?", "repo1", true},
+		{"repo?", "repo/", false},
+		{"pkg/*.go", "pkg/main.go", true},
+		{"pkg/*.go", "pkg/sub/main.go", false},
+		{"pkg/**", "pkg/sub/main.go", true},
+		{"pkg/**", "pkg", false},
+		{"**/zz_generated*.go", "zz_generated.deepcopy.go", true},
+		{"**/zz_generated*.go", "api/v1/zz_generated.deepcopy.go", true},
+		{"**/vendor/**", "cmd/vendor/x/y.go", true},
+		{"vendor/**", "cmd/vendor/x/y.go", false},
+		{"a.b", "axb", false},
+		{"[abc].go", "[abc].go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := compileGlob(tt.pattern).Match(tt.name); got != tt.want {
+				t.Errorf("compileGlob(%q).Match(%q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	policyYAML := `
+default: 40
+require_coverage: true
+repos:
+  - match: myorg/special
+    min: 90
+  - match: "*-operator"
+    min: 60
+files:
+  - repo: "*-operator"
+    path: "pkg/controller/**"
+    min: 50
+`
+	if err := os.WriteFile(filename, []byte(policyYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := loadPolicy(filename)
+	if err != nil {
+		t.Fatalf("loadPolicy: %v", err)
+	}
+
+	files := &CodecovReport{Files: []FileCoverage{{Name: "pkg/controller/x/reconcile.go"}, {Name: "main.go"}}}
+	files.Files[0].Totals.Coverage = 30
+	files.Files[1].Totals.Coverage = 10
+
+	tests := []struct {
+		name   string
+		result repoResult
+		want   []Violation
+	}{
+		{
+			name:   "above default",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "tool", Coverage: 45, Status: StatusCovered}},
+		},
+		{
+			name:   "below default",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "tool", Coverage: 35, Status: StatusCovered}},
+			want:   []Violation{{Repo: "myorg/tool", Coverage: 35, Min: 40}},
+		},
+		{
+			name:   "first matching rule",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "special", Coverage: 80, Status: StatusCovered}},
+			want:   []Violation{{Repo: "myorg/special", Coverage: 80, Min: 90}},
+		},
+		{
+			name:   "no coverage required",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "tool", Status: StatusNoUploads}},
+			want:   []Violation{{Repo: "myorg/tool", Min: 40, Reason: "no uploads"}},
+		},
+		{
+			name:   "api errors are skipped",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "tool", Status: StatusTransientError}},
+		},
+		{
+			name:   "file rule",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "x-operator", Coverage: 70, Status: StatusCovered}, Report: files},
+			want:   []Violation{{Repo: "myorg/x-operator", File: "pkg/controller/x/reconcile.go", Coverage: 30, Min: 50}},
+		},
+		{
+			name:   "file rule of another repo",
+			result: repoResult{Coverage: RepoCoverage{Org: "myorg", Name: "tool", Coverage: 70, Status: StatusCovered}, Report: files},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Evaluate([]repoResult{tt.result}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"invalid yaml", "repos: ["},
+		{"repo rule without match", "repos:\n  - min: 10\n"},
+		{"file rule without path", "files:\n  - repo: x\n    min: 10\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(filename, []byte(tt.policy), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadPolicy(filename); err == nil {
+				t.Errorf("loadPolicy(%q) succeeded, want an error", tt.policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// Name of the check run created on each repo
+const coverageCheckName = "coverage"
+
+// Label and hidden body marker identifying the tracking issue of a repo
+const (
+	coverageIssueLabel  = "coverage"
+	coverageIssueMarker = "<!-- coverage-tracking-issue -->"
+)
+
+// publishOptions are the flags for posting results back to GitHub
+type publishOptions struct {
+	mode      string
+	threshold float64
+	dryRun    bool
+}
+
+// addPublishFlags registers the publishing flags on fs
+func addPublishFlags(fs *flag.FlagSet) *publishOptions {
+	opts := &publishOptions{}
+	fs.StringVar(&opts.mode, "publish", "", "Post results to GitHub: check (check run on the branch HEAD, needs a GitHub App token) or issue (tracking issue below -publish-threshold)")
+	fs.Float64Var(&opts.threshold, "publish-threshold", 0, "Coverage percentage below which check runs fail and tracking issues are opened")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Print the GitHub API calls -publish would make instead of making them")
+	return opts
+}
+
+// validate checks the flags before any coverage is collected
+func (o *publishOptions) validate() error {
+	switch o.mode {
+	case "", "check":
+		return nil
+	case "issue":
+		if o.threshold <= 0 {
+			return fmt.Errorf("-publish issue needs a -publish-threshold")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown -publish mode %q (want check or issue)", o.mode)
+}
+
+// publisher posts coverage results to GitHub. In dry-run mode it still reads from
+// GitHub to find existing check runs and issues, but only prints the writes.
+type publisher struct {
+	client    *github.Client
+	threshold float64
+	dryRun    bool
+	out       io.Writer // receives the API calls in dry-run mode
+}
+
+// publish posts every result with the configured mode and returns the number of repos
+// that could not be published
+func (o *publishOptions) publish(ctx context.Context, ghClient *github.Client, out io.Writer, results []repoResult) int {
+	if o.mode == "" {
+		return 0
+	}
+
+	p := &publisher{client: ghClient, threshold: o.threshold, dryRun: o.dryRun, out: out}
+	failures := 0
+	for _, result := range results {
+		repo := result.Coverage
+		// errors say nothing about the repo's coverage, so don't publish them
+		if repo.Status.IsError() {
+			continue
+		}
+		// nor do repos that don't use the coverage provider at all
+		if repo.Status == StatusNotConfigured {
+			continue
+		}
+
+		var err error
+		switch o.mode {
+		case "check":
+			err = p.publishCheckRun(ctx, repo)
+		case "issue":
+			err = p.publishIssue(ctx, repo)
+		}
+		if err != nil {
+			slog.Error("Error publishing coverage", "repo", repo.FullName(), "mode", o.mode, "error", err)
+			failures++
+		}
+	}
+	return failures
+}
+
+// below reports whether repo is under the publishing threshold
+func (p *publisher) below(repo RepoCoverage) bool {
+	return p.threshold > 0 && repo.Status.HasCoverage() && repo.Coverage < p.threshold
+}
+
+// summary is the Markdown body shared by check runs and issues
+func (p *publisher) summary(repo RepoCoverage) string {
+	var b strings.Builder
+	if repo.Status.HasCoverage() {
+		fmt.Fprintf(&b, "Coverage of `%s` is **%.2f%%**", repo.FullName(), repo.Coverage)
+	} else {
+		fmt.Fprintf(&b, "Coverage of `%s` is unknown: %s", repo.FullName(), repo.Status)
+	}
+	if p.threshold > 0 {
+		fmt.Fprintf(&b, " (threshold %.2f%%)", p.threshold)
+	}
+	b.WriteString(".\n\n")
+	if repo.RawCoverage != nil {
+		fmt.Fprintf(&b, "- Raw coverage, including ignored files: %.2f%%\n", *repo.RawCoverage)
+	}
+	if repo.Branch != "" {
+		fmt.Fprintf(&b, "- Branch: `%s`\n", repo.Branch)
+	}
+	if repo.Commit != "" {
+		fmt.Fprintf(&b, "- Commit: `%s`\n", repo.Commit)
+	}
+	return b.String()
+}
+
+// publishCheckRun creates the coverage check run on the branch HEAD, or updates the one
+// a previous run created on the same commit
+func (p *publisher) publishCheckRun(ctx context.Context, repo RepoCoverage) error {
+	sha := repo.Commit
+	if sha == "" {
+		sha = headSHA(ctx, p.client, repoTarget{Org: repo.Org, Name: repo.Name, Branch: repo.Branch})
+		if sha == "" {
+			return fmt.Errorf("branch HEAD of %s is unknown", repo.FullName())
+		}
+	}
+
+	conclusion := "neutral"
+	title := "No coverage"
+	if repo.Status.HasCoverage() {
+		title = fmt.Sprintf("%.2f%% coverage", repo.Coverage)
+		if p.threshold > 0 {
+			conclusion = "success"
+			if p.below(repo) {
+				conclusion = "failure"
+			}
+		}
+	}
+	output := &github.CheckRunOutput{Title: github.String(title), Summary: github.String(p.summary(repo))}
+
+	existing, err := p.findCheckRun(ctx, repo, sha)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		id := existing.GetID()
+		if p.dryRun {
+			fmt.Fprintf(p.out, "[dry-run] PATCH /repos/%s/check-runs/%d conclusion=%s title=%q\n", repo.FullName(), id, conclusion, title)
+			return nil
+		}
+		// the update sets every field, so repeating it has no further effect
+		return withGitHubRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := p.client.Checks.UpdateCheckRun(ctx, repo.Org, repo.Name, id, github.UpdateCheckRunOptions{
+				Name:       coverageCheckName,
+				Status:     github.String("completed"),
+				Conclusion: github.String(conclusion),
+				Output:     output,
+			})
+			return resp, err
+		})
+	}
+
+	if p.dryRun {
+		fmt.Fprintf(p.out, "[dry-run] POST /repos/%s/check-runs head_sha=%s conclusion=%s title=%q\n", repo.FullName(), sha, conclusion, title)
+		return nil
+	}
+	return withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+		_, resp, err := p.client.Checks.CreateCheckRun(ctx, repo.Org, repo.Name, github.CreateCheckRunOptions{
+			Name:       coverageCheckName,
+			HeadSHA:    sha,
+			Status:     github.String("completed"),
+			Conclusion: github.String(conclusion),
+			Output:     output,
+		})
+		return resp, err
+	}, func() (bool, error) {
+		run, err := p.findCheckRun(ctx, repo, sha)
+		return run != nil, err
+	})
+}
+
+// findCheckRun returns the coverage check run on commit sha, if any
+func (p *publisher) findCheckRun(ctx context.Context, repo RepoCoverage, sha string) (*github.CheckRun, error) {
+	var existing *github.ListCheckRunsResults
+	err := withGitHubRetry(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		existing, resp, err = p.client.Checks.ListCheckRunsForRef(ctx, repo.Org, repo.Name, sha, &github.ListCheckRunsOptions{CheckName: github.String(coverageCheckName)})
+		return resp, err
+	})
+	if err != nil || existing == nil || len(existing.CheckRuns) == 0 {
+		return nil, err
+	}
+	return existing.CheckRuns[0], nil
+}
+
+// publishIssue opens the tracking issue of a repo below the threshold, or updates the
+// open one. Once coverage is back above the threshold, the issue is closed.
+func (p *publisher) publishIssue(ctx context.Context, repo RepoCoverage) error {
+	if !repo.Status.HasCoverage() {
+		return nil
+	}
+
+	issue, err := p.findTrackingIssue(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	if !p.below(repo) {
+		if issue == nil {
+			return nil
+		}
+		comment := fmt.Sprintf("Coverage is back at %.2f%%, above the %.2f%% threshold. Closing.", repo.Coverage, p.threshold)
+		if p.dryRun {
+			fmt.Fprintf(p.out, "[dry-run] POST /repos/%s/issues/%d/comments body=%q\n", repo.FullName(), issue.GetNumber(), comment)
+			fmt.Fprintf(p.out, "[dry-run] PATCH /repos/%s/issues/%d state=closed\n", repo.FullName(), issue.GetNumber())
+			return nil
+		}
+		// allow for clock skew between us and GitHub when looking for the comment
+		since := time.Now().Add(-5 * time.Minute)
+		err := withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := p.client.Issues.CreateComment(ctx, repo.Org, repo.Name, issue.GetNumber(), &github.IssueComment{Body: github.String(comment)})
+			return resp, err
+		}, func() (bool, error) {
+			return p.hasComment(ctx, repo, issue.GetNumber(), comment, since)
+		})
+		if err != nil {
+			return err
+		}
+		return withGitHubRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := p.client.Issues.Edit(ctx, repo.Org, repo.Name, issue.GetNumber(), &github.IssueRequest{State: github.String("closed")})
+			return resp, err
+		})
+	}
+
+	title := fmt.Sprintf("Test coverage is below %.2f%%", p.threshold)
+	body := coverageIssueMarker + "\n" + p.summary(repo) + "\nThis issue is updated by the coverage tool and closed once coverage is back above the threshold.\n"
+
+	if issue != nil {
+		// only touch the issue when its content changed, so re-runs don't notify watchers
+		if issue.GetBody() == body {
+			return nil
+		}
+		if p.dryRun {
+			fmt.Fprintf(p.out, "[dry-run] PATCH /repos/%s/issues/%d title=%q\n", repo.FullName(), issue.GetNumber(), title)
+			return nil
+		}
+		return withGitHubRetry(ctx, func() (*github.Response, error) {
+			_, resp, err := p.client.Issues.Edit(ctx, repo.Org, repo.Name, issue.GetNumber(), &github.IssueRequest{Title: github.String(title), Body: github.String(body)})
+			return resp, err
+		})
+	}
+
+	if p.dryRun {
+		fmt.Fprintf(p.out, "[dry-run] POST /repos/%s/issues title=%q labels=%s\n", repo.FullName(), title, coverageIssueLabel)
+		return nil
+	}
+	return withGitHubWriteRetry(ctx, func() (*github.Response, error) {
+		_, resp, err := p.client.Issues.Create(ctx, repo.Org, repo.Name, &github.IssueRequest{
+			Title:  github.String(title),
+			Body:   github.String(body),
+			Labels: &[]string{coverageIssueLabel},
+		})
+		return resp, err
+	}, func() (bool, error) {
+		issue, err := p.findTrackingIssue(ctx, repo)
+		return issue != nil, err
+	})
+}
+
+// hasComment reports whether an issue has a comment with the given body, created or
+// updated after since
+func (p *publisher) hasComment(ctx context.Context, repo RepoCoverage, number int, body string, since time.Time) (bool, error) {
+	opts := &github.IssueListCommentsOptions{Since: &since, ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		var comments []*github.IssueComment
+		var resp *github.Response
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var err error
+			comments, resp, err = p.client.Issues.ListComments(ctx, repo.Org, repo.Name, number, opts)
+			return resp, err
+		})
+		if err != nil {
+			return false, err
+		}
+
+		for _, comment := range comments {
+			if comment.GetBody() == body {
+				return true, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// findTrackingIssue returns the open issue a previous run created for repo, if any
+func (p *publisher) findTrackingIssue(ctx context.Context, repo RepoCoverage) (*github.Issue, error) {
+	opts := &github.IssueListByRepoOptions{State: "open", Labels: []string{coverageIssueLabel}, ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		var issues []*github.Issue
+		var resp *github.Response
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var err error
+			issues, resp, err = p.client.Issues.ListByRepo(ctx, repo.Org, repo.Name, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, issue := range issues {
+			if !issue.IsPullRequest() && strings.Contains(issue.GetBody(), coverageIssueMarker) {
+				return issue, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
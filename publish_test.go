@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// fakeGitHubWrites serves the issue and check run endpoints used by the publisher. The
+// first failNext writes are answered with 502, after being stored if applyFailed is set,
+// like a write that timed out after GitHub saved it.
+type fakeGitHubWrites struct {
+	mu          sync.Mutex
+	failNext    int
+	applyFailed bool
+	writes      int
+	issues      []map[string]interface{}
+	comments    []map[string]interface{}
+	checkRuns   []map[string]interface{}
+}
+
+func (f *fakeGitHubWrites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var stored *[]map[string]interface{}
+	switch r.URL.Path {
+	case "/repos/myorg/myrepo/issues":
+		stored = &f.issues
+	case "/repos/myorg/myrepo/issues/7/comments":
+		stored = &f.comments
+	case "/repos/myorg/myrepo/check-runs", "/repos/myorg/myrepo/commits/abc/check-runs":
+		stored = &f.checkRuns
+	case "/repos/myorg/myrepo/issues/7":
+		w.Write([]byte(`{"number": 7}`))
+		return
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if stored == &f.checkRuns {
+			json.NewEncoder(w).Encode(map[string]interface{}{"total_count": len(f.checkRuns), "check_runs": f.checkRuns})
+			return
+		}
+		json.NewEncoder(w).Encode(*stored)
+		return
+	}
+
+	f.writes++
+	var body map[string]interface{}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &body)
+	delete(body, "labels") // sent as names, returned as objects
+	body["number"] = 7
+	body["id"] = len(*stored) + 1
+
+	failed := f.failNext > 0
+	if failed {
+		f.failNext--
+	}
+	if !failed || f.applyFailed {
+		*stored = append(*stored, body)
+	}
+	if failed {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestPublishNonIdempotentWrites(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		coverage    float64
+		openIssue   bool
+		failNext    int
+		applyFailed bool
+		wantWrites  int
+		wantStored  int
+	}{
+		{name: "issue created", mode: "issue", coverage: 10, wantWrites: 1, wantStored: 1},
+		{name: "issue saved despite error", mode: "issue", coverage: 10, failNext: 1, applyFailed: true, wantWrites: 1, wantStored: 1},
+		{name: "issue create failed", mode: "issue", coverage: 10, failNext: 1, wantWrites: 2, wantStored: 1},
+		{name: "comment saved despite error", mode: "issue", coverage: 90, openIssue: true, failNext: 1, applyFailed: true, wantWrites: 1, wantStored: 1},
+		{name: "comment failed", mode: "issue", coverage: 90, openIssue: true, failNext: 1, wantWrites: 2, wantStored: 1},
+		{name: "check run saved despite error", mode: "check", coverage: 10, failNext: 1, applyFailed: true, wantWrites: 1, wantStored: 1},
+		{name: "check run create failed", mode: "check", coverage: 10, failNext: 2, wantWrites: 3, wantStored: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fastRetries(t, 3)
+			fake := &fakeGitHubWrites{failNext: tt.failNext, applyFailed: tt.applyFailed}
+			if tt.openIssue {
+				fake.issues = []map[string]interface{}{{"number": 7, "body": coverageIssueMarker + "\nold"}}
+			}
+			opts := &publishOptions{mode: tt.mode, threshold: 50}
+			results := []repoResult{{Coverage: RepoCoverage{Org: "myorg", Name: "myrepo", Commit: "abc", Coverage: tt.coverage, Status: StatusCovered}}}
+
+			if failures := opts.publish(context.Background(), newTestGitHubClient(t, fake), io.Discard, results); failures != 0 {
+				t.Fatalf("publish() failed for %d repos", failures)
+			}
+
+			stored := len(fake.checkRuns)
+			if tt.mode == "issue" {
+				stored = len(fake.issues) + len(fake.comments)
+				if tt.openIssue {
+					stored--
+				}
+			}
+			if fake.writes != tt.wantWrites || stored != tt.wantStored {
+				t.Errorf("made %d writes storing %d objects, want %d writes storing %d", fake.writes, stored, tt.wantWrites, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestPublishSkipsUnconfiguredRepos(t *testing.T) {
+	ghClient := newTestGitHubClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}))
+	opts := &publishOptions{mode: "check"}
+	results := []repoResult{
+		{Coverage: RepoCoverage{Org: "myorg", Name: "unconfigured", Commit: "abc", Status: StatusNotConfigured}},
+		{Coverage: RepoCoverage{Org: "myorg", Name: "broken", Commit: "abc", Status: StatusAuthError}},
+	}
+	if failures := opts.publish(context.Background(), ghClient, io.Discard, results); failures != 0 {
+		t.Errorf("publish() failed for %d repos", failures)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// prCoverage is the coverage impact of one open pull request
+type prCoverage struct {
+	Org     string
+	Repo    string
+	Number  int
+	Title   string
+	Author  string
+	URL     string
+	Draft   bool
+	HeadSHA string
+
+	Patch  *float64 // coverage of the changed lines, nil if the PR changes no coverable lines
+	Base   float64  // project coverage of the base commit
+	Head   float64  // project coverage of the PR head
+	Status CoverageStatus
+	Err    error
+}
+
+// FullName returns the "org/repo#number" name of the PR
+func (p prCoverage) FullName() string {
+	return fmt.Sprintf("%s/%s#%d", p.Org, p.Repo, p.Number)
+}
+
+// ProjectDelta returns the change in project coverage points the PR would cause
+func (p prCoverage) ProjectDelta() float64 {
+	return p.Head - p.Base
+}
+
+// Lowers reports whether merging the PR would lower coverage, either because project
+// coverage drops or because the changed lines are covered less than the project
+func (p prCoverage) Lowers() bool {
+	if !p.Status.HasCoverage() {
+		return false
+	}
+	return p.ProjectDelta() < 0 || (p.Patch != nil && *p.Patch < p.Base)
+}
+
+// runPRs implements the "prs" command, which reports patch coverage and project delta
+// of open pull requests and ranks the ones that would lower coverage first
+func runPRs(args []string) int {
+	fs := flag.NewFlagSet("prs", flag.ExitOnError)
+	targetOpts := addTargetFlags(fs)
+	collect := addCollectFlags(fs)
+	format := fs.String("format", "text", "Output format: text, csv, json or markdown")
+	output := fs.String("output", "", "Write the report to this file instead of stdout")
+	includeDrafts := fs.Bool("include-drafts", false, "Also report draft pull requests")
+	riskyOnly := fs.Bool("risky-only", false, "Only list pull requests that would lower coverage")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if *format != "text" && *format != "csv" && *format != "json" && *format != "markdown" && *format != "md" {
+		log.Fatalf("❌ unknown report format %q (want text, csv, json or markdown)", *format)
+	}
+	// patch coverage comes from Codecov's compare API only
+	if collect.provider != "codecov" {
+		log.Fatalf("❌ pull request coverage is only available from codecov, not %s", collect.provider)
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+	codecovToken := os.Getenv("CODECOV_TOKEN")
+	if codecovToken == "" {
+		log.Fatal("❌ Please set the CODECOV_TOKEN environment variable")
+	}
+	setRateLimit(githubLimiter, collect.githubRPS)
+	setRateLimit(codecovLimiter, collect.codecovRPS)
+
+	ctx := context.Background()
+	ghClient := newGitHubClient(githubToken)
+	targets, err := targetOpts.resolve(ctx, ghClient)
+	if err != nil {
+		log.Fatalf("❌ Error getting repositories: %v", err)
+	}
+
+	// List open PRs of every repo, then fetch their coverage
+	pulls := make([][]*github.PullRequest, len(targets))
+	listErrors := make([]error, len(targets))
+	parallel(len(targets), collect.concurrency, func(i int) {
+		pulls[i], listErrors[i] = getOpenPullRequests(ctx, ghClient, targets[i])
+	})
+
+	exitCode := exitOK
+	var prs []prCoverage
+	for i, target := range targets {
+		if listErrors[i] != nil {
+			slog.Error("Error listing pull requests", "repo", target.FullName(), "error", listErrors[i])
+			exitCode = exitAPIErrors
+			continue
+		}
+		for _, pr := range pulls[i] {
+			if pr.GetDraft() && !*includeDrafts {
+				continue
+			}
+			prs = append(prs, prCoverage{
+				Org:     target.Org,
+				Repo:    target.Name,
+				Number:  pr.GetNumber(),
+				Title:   pr.GetTitle(),
+				Author:  pr.GetUser().GetLogin(),
+				URL:     pr.GetHTMLURL(),
+				Draft:   pr.GetDraft(),
+				HeadSHA: pr.GetHead().GetSHA(),
+			})
+		}
+	}
+
+	parallel(len(prs), collect.concurrency, func(i int) {
+		getPullRequestCoverage(&prs[i], codecovToken)
+	})
+
+	var report []prCoverage
+	for _, pr := range prs {
+		if pr.Status.IsError() {
+			slog.Error("Error getting pull request coverage", "pr", pr.FullName(), "status", pr.Status, "error", pr.Err)
+			exitCode = exitAPIErrors
+		}
+		if *riskyOnly && !pr.Lowers() {
+			continue
+		}
+		report = append(report, pr)
+	}
+	rankPRs(report)
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+	}
+
+	switch *format {
+	case "csv":
+		err = writePRsCSV(out, report)
+	case "json":
+		err = writePRsJSON(out, report)
+	case "markdown", "md":
+		err = writePRsMarkdown(out, report)
+	default:
+		err = writePRsText(out, report)
+	}
+	if err != nil {
+		log.Fatalf("❌ Error writing report: %v", err)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing report: %v", err)
+		}
+	}
+	return exitCode
+}
+
+// Fetch all open pull requests of a repository using pagination
+func getOpenPullRequests(ctx context.Context, ghClient *github.Client, target repoTarget) ([]*github.PullRequest, error) {
+	var all []*github.PullRequest
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		var pulls []*github.PullRequest
+		var resp *github.Response
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var err error
+			pulls, resp, err = ghClient.PullRequests.List(ctx, target.Org, target.Name, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, pulls...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return all, nil
+}
+
+// Fetch patch and project coverage of a pull request from Codecov's compare API
+func getPullRequestCoverage(pr *prCoverage, token string) {
+	endpoint := fmt.Sprintf("%s/%s/repos/%s/compare/", codecovAPIBase, pr.Org, pr.Repo)
+	query := url.Values{"pullid": {strconv.Itoa(pr.Number)}}
+
+	type totals struct {
+		Coverage *float64 `json:"coverage"`
+	}
+	var data struct {
+		Totals *struct {
+			Base  *totals `json:"base"`
+			Head  *totals `json:"head"`
+			Patch *totals `json:"patch"`
+		} `json:"totals"`
+	}
+	if err := getCodecov(endpoint, token, query, &data); err != nil {
+		pr.Status, pr.Err = statusForError(err), err
+		if pr.Status == StatusNotConfigured {
+			// Codecov has not compared this PR, usually because nothing was uploaded for it
+			pr.Status, pr.Err = StatusNoUploads, nil
+		}
+		return
+	}
+
+	if data.Totals == nil || data.Totals.Base == nil || data.Totals.Head == nil ||
+		data.Totals.Base.Coverage == nil || data.Totals.Head.Coverage == nil {
+		pr.Status = StatusNoUploads
+		return
+	}
+
+	pr.Base = *data.Totals.Base.Coverage
+	pr.Head = *data.Totals.Head.Coverage
+	if data.Totals.Patch != nil {
+		pr.Patch = data.Totals.Patch.Coverage
+	}
+	pr.Status = coverageResult(pr.Repo, pr.Head).Status
+}
+
+// rankPRs sorts PRs that would lower coverage first, by project delta and then patch
+// coverage (lowest first), followed by the others and PRs without coverage
+func rankPRs(prs []prCoverage) {
+	rank := func(p prCoverage) int {
+		switch {
+		case p.Lowers():
+			return 0
+		case p.Status.HasCoverage():
+			return 1
+		}
+		return 2
+	}
+	patch := func(p prCoverage) float64 {
+		if p.Patch == nil {
+			return 100
+		}
+		return *p.Patch
+	}
+
+	sort.SliceStable(prs, func(i, j int) bool {
+		a, b := prs[i], prs[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		if a.ProjectDelta() != b.ProjectDelta() {
+			return a.ProjectDelta() < b.ProjectDelta()
+		}
+		if patch(a) != patch(b) {
+			return patch(a) < patch(b)
+		}
+		return a.FullName() < b.FullName()
+	})
+}
+
+func formatPatch(p prCoverage) string {
+	if !p.Status.HasCoverage() {
+		return p.Status.String()
+	}
+	if p.Patch == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", *p.Patch)
+}
+
+func formatProject(p prCoverage) string {
+	if !p.Status.HasCoverage() {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%% -> %.2f%% (%+.2f)", p.Base, p.Head, p.ProjectDelta())
+}
+
+func writePRsText(w io.Writer, prs []prCoverage) error {
+	fmt.Fprintln(w, "Pull Request, Patch Coverage, Project Coverage, Title")
+	for _, pr := range prs {
+		line := fmt.Sprintf("%s, %s, %s, %s", pr.FullName(), formatPatch(pr), formatProject(pr), pr.Title)
+		if pr.Lowers() {
+			line += " ⚠️ lowers coverage"
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+func writePRsCSV(w io.Writer, prs []prCoverage) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Organization", "Repository", "PR", "Title", "Author", "URL", "Patch Coverage %", "Base Coverage %", "Head Coverage %", "Project Delta", "Lowers Coverage", "Status", "Error"})
+	for _, pr := range prs {
+		patch, base, head, delta := "", "", "", ""
+		if pr.Status.HasCoverage() {
+			if pr.Patch != nil {
+				patch = fmt.Sprintf("%.2f", *pr.Patch)
+			}
+			base = fmt.Sprintf("%.2f", pr.Base)
+			head = fmt.Sprintf("%.2f", pr.Head)
+			delta = fmt.Sprintf("%.2f", pr.ProjectDelta())
+		}
+		errMsg := ""
+		if pr.Err != nil {
+			errMsg = pr.Err.Error()
+		}
+		writer.Write([]string{pr.Org, pr.Repo, fmt.Sprint(pr.Number), pr.Title, pr.Author, pr.URL,
+			patch, base, head, delta, fmt.Sprint(pr.Lowers()), pr.Status.String(), errMsg})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writePRsJSON(w io.Writer, prs []prCoverage) error {
+	type jsonPR struct {
+		Org            string         `json:"org"`
+		Repo           string         `json:"repo"`
+		Number         int            `json:"number"`
+		Title          string         `json:"title"`
+		Author         string         `json:"author"`
+		URL            string         `json:"url"`
+		Draft          bool           `json:"draft,omitempty"`
+		HeadSHA        string         `json:"head_sha"`
+		PatchCoverage  *float64       `json:"patch_coverage"`
+		BaseCoverage   *float64       `json:"base_coverage"`
+		HeadCoverage   *float64       `json:"head_coverage"`
+		ProjectDelta   *float64       `json:"project_delta"`
+		LowersCoverage bool           `json:"lowers_coverage"`
+		Status         CoverageStatus `json:"status"`
+		Error          string         `json:"error,omitempty"`
+	}
+
+	entries := make([]jsonPR, 0, len(prs))
+	for _, pr := range prs {
+		entry := jsonPR{Org: pr.Org, Repo: pr.Repo, Number: pr.Number, Title: pr.Title, Author: pr.Author, URL: pr.URL,
+			Draft: pr.Draft, HeadSHA: pr.HeadSHA, LowersCoverage: pr.Lowers(), Status: pr.Status}
+		if pr.Status.HasCoverage() {
+			base, head, delta := pr.Base, pr.Head, pr.ProjectDelta()
+			entry.PatchCoverage, entry.BaseCoverage, entry.HeadCoverage, entry.ProjectDelta = pr.Patch, &base, &head, &delta
+		}
+		if pr.Err != nil {
+			entry.Error = pr.Err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return writeJSON(w, struct {
+		PullRequests []jsonPR `json:"pull_requests"`
+	}{entries})
+}
+
+func writePRsMarkdown(w io.Writer, prs []prCoverage) error {
+	fmt.Fprintln(w, "## Coverage impact of open pull requests")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Pull Request | Title | Author | Patch | Project | |")
+	fmt.Fprintln(w, "|---|---|---|---:|---:|---|")
+	for _, pr := range prs {
+		warning := ""
+		if pr.Lowers() {
+			warning = "⚠️"
+		}
+		fmt.Fprintf(w, "| [%s](%s) | %s | %s | %s | %s | %s |\n", markdownEscape(pr.FullName()), pr.URL,
+			markdownEscape(pr.Title), markdownEscape(pr.Author), formatPatch(pr), formatProject(pr), warning)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+
+func TestPRCoverageLowers(t *testing.T) {
+	tests := []struct {
+		name string
+		pr   prCoverage
+		want bool
+	}{
+		{"project drops", prCoverage{Base: 80, Head: 79.5, Patch: floatPtr(90), Status: StatusCovered}, true},
+		{"patch below project", prCoverage{Base: 80, Head: 80.1, Patch: floatPtr(60), Status: StatusCovered}, true},
+		{"patch equals project", prCoverage{Base: 80, Head: 80, Patch: floatPtr(80), Status: StatusCovered}, false},
+		{"no coverable lines", prCoverage{Base: 80, Head: 80, Status: StatusCovered}, false},
+		{"project rises", prCoverage{Base: 80, Head: 82, Patch: floatPtr(95), Status: StatusCovered}, false},
+		{"drops to zero", prCoverage{Base: 10, Head: 0, Status: StatusZeroCoverage}, true},
+		{"no uploads", prCoverage{Base: 80, Head: 10, Status: StatusNoUploads}, false},
+		{"error", prCoverage{Status: StatusTransientError}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pr.Lowers(); got != tt.want {
+				t.Errorf("Lowers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankPRs(t *testing.T) {
+	pr := func(number int, base, head float64, patch *float64, status CoverageStatus) prCoverage {
+		return prCoverage{Org: "acme", Repo: "api", Number: number, Base: base, Head: head, Patch: patch, Status: status}
+	}
+	tests := []struct {
+		name string
+		prs  []prCoverage
+		want []int
+	}{
+		{
+			name: "lowering first by project delta",
+			prs: []prCoverage{
+				pr(1, 80, 79, nil, StatusCovered),
+				pr(2, 80, 75, nil, StatusCovered),
+				pr(3, 80, 81, nil, StatusCovered),
+			},
+			want: []int{2, 1, 3},
+		},
+		{
+			name: "delta ties broken by patch coverage",
+			prs: []prCoverage{
+				pr(1, 80, 79, floatPtr(70), StatusCovered),
+				pr(2, 80, 79, floatPtr(40), StatusCovered),
+				pr(3, 80, 79, nil, StatusCovered),
+			},
+			want: []int{2, 1, 3},
+		},
+		{
+			name: "full ties broken by name",
+			prs: []prCoverage{
+				pr(12, 80, 80, floatPtr(90), StatusCovered),
+				pr(10, 80, 80, floatPtr(90), StatusCovered),
+				pr(11, 80, 80, floatPtr(90), StatusCovered),
+			},
+			want: []int{10, 11, 12},
+		},
+		{
+			name: "missing coverage last",
+			prs: []prCoverage{
+				pr(1, 0, 0, nil, StatusNoUploads),
+				pr(2, 0, 0, nil, StatusTransientError),
+				pr(3, 80, 82, nil, StatusCovered),
+				pr(4, 80, 70, nil, StatusCovered),
+			},
+			want: []int{4, 3, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rankPRs(tt.prs)
+			var got []int
+			for _, pr := range tt.prs {
+				got = append(got, pr.Number)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankPRs() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPullRequestCoverage(t *testing.T) {
+	totals := func(base, head, patch interface{}) map[string]interface{} {
+		cov := func(v interface{}) interface{} {
+			if v == nil {
+				return nil
+			}
+			return map[string]interface{}{"coverage": v}
+		}
+		return map[string]interface{}{"totals": map[string]interface{}{"base": cov(base), "head": cov(head), "patch": cov(patch)}}
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus CoverageStatus
+		wantBase   float64
+		wantHead   float64
+		wantPatch  *float64
+	}{
+		{"covered", serveJSON(t, http.StatusOK, totals(80.0, 78.5, 50.0)), StatusCovered, 80, 78.5, floatPtr(50)},
+		{"no coverable lines", serveJSON(t, http.StatusOK, totals(80.0, 80.0, nil)), StatusCovered, 80, 80, nil},
+		{"head drops to zero", serveJSON(t, http.StatusOK, totals(10.0, 0.0, 0.0)), StatusZeroCoverage, 10, 0, floatPtr(0)},
+		{"missing base", serveJSON(t, http.StatusOK, totals(nil, 78.5, 50.0)), StatusNoUploads, 0, 0, nil},
+		{"missing head", serveJSON(t, http.StatusOK, totals(80.0, nil, nil)), StatusNoUploads, 0, 0, nil},
+		{"no totals", serveJSON(t, http.StatusOK, map[string]interface{}{}), StatusNoUploads, 0, 0, nil},
+		{"not compared", serveJSON(t, http.StatusNotFound, nil), StatusNoUploads, 0, 0, nil},
+		{"bad token", serveJSON(t, http.StatusUnauthorized, nil), StatusAuthError, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/acme/repos/api/compare/", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("pullid") != "7" {
+					t.Errorf("pullid = %q, want 7", r.URL.Query().Get("pullid"))
+				}
+				tt.handler(w, r)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			defer func(base string) { codecovAPIBase = base }(codecovAPIBase)
+			codecovAPIBase = server.URL
+
+			pr := prCoverage{Org: "acme", Repo: "api", Number: 7}
+			getPullRequestCoverage(&pr, "secret")
+			if pr.Status != tt.wantStatus || pr.Base != tt.wantBase || pr.Head != tt.wantHead || !reflect.DeepEqual(pr.Patch, tt.wantPatch) {
+				t.Errorf("got %v base %v head %v patch %v, want %v base %v head %v patch %v (err %v)",
+					pr.Status, pr.Base, pr.Head, pr.Patch, tt.wantStatus, tt.wantBase, tt.wantHead, tt.wantPatch, pr.Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// Token buckets shared by every request to each API. They start unlimited and are
+// configured from flags in main.
+var (
+	githubLimiter   = rate.NewLimiter(rate.Inf, 1)
+	codecovLimiter  = rate.NewLimiter(rate.Inf, 1)
+	providerLimiter = rate.NewLimiter(rate.Inf, 1) // Coveralls and SonarQube
+)
+
+// HTTP client used for all Codecov API calls
+var codecovHTTPClient = &http.Client{
+	Transport: &retryTransport{
+		base: &rateLimitedTransport{limiter: codecovLimiter, base: newAPITransport()},
+	},
+}
+
+// HTTP client used for all Coveralls and SonarQube API calls
+var providerHTTPClient = &http.Client{
+	Transport: &retryTransport{
+		base: &rateLimitedTransport{limiter: providerLimiter, base: newAPITransport()},
+	},
+}
+
+// rateLimitedTransport waits for a token from limiter before sending each request
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	base    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// setRateLimit sets limiter to rps requests per second; zero or less disables the limit
+func setRateLimit(limiter *rate.Limiter, rps float64) {
+	if rps <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	limiter.SetLimit(rate.Limit(rps))
+	limiter.SetBurst(int(math.Max(1, math.Ceil(rps))))
+}
@@ -1,12 +1,16 @@
+// Run with the shared logger and repo selection: go run repolist_and_cc.go logging.go targets.go filters.go retry.go
 package main
 
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"time"
 
@@ -25,31 +29,34 @@ type CodecovResponse struct {
 	} `json:"commit"`
 }
 
-// getCoverage calls the Codecov API for the given organization/repository and returns the coverage percentage.
-func getCoverage(org, repo, token string) (float64, error) {
-	// Construct the Codecov API URL
-	url := fmt.Sprintf("https://codecov.io/api/gh/%s/%s?branch=main&token=%s", org, repo, token)
-	fmt.Println("[DEBUG] Querying Codecov API:", url) // Print API URL for debugging
+// getCoverage calls the Codecov API for the given organization/repository/branch and returns the coverage percentage.
+func getCoverage(org, repo, branch, token string) (float64, error) {
+	// Construct the Codecov API URL; the token goes in a header so it never ends up in the URL
+	url := fmt.Sprintf("https://codecov.io/api/gh/%s/%s?branch=%s", org, repo, neturl.QueryEscape(branch))
+	slog.Debug("Querying Codecov API", "url", url)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "token "+token)
 
 	// Create an HTTP client with a timeout.
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	resp, err := client.Get(url)
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("failed to call Codecov API: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Debugging: Print HTTP status
-	fmt.Printf("[DEBUG] Codecov API Response: %s (Status Code: %d)\n", resp.Status, resp.StatusCode)
-
-	// Read full response body for debugging
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read Codecov API response: %v", err)
 	}
-	fmt.Println("[DEBUG] Codecov API Response Body:", string(body))
+	// Bodies are redacted by the logger, and only logged at debug level
+	slog.Debug("Codecov API response", "status", resp.StatusCode, "body", string(body))
 
 	if resp.StatusCode != 200 {
 		return 0, fmt.Errorf("Codecov API returned non-200 status: %d", resp.StatusCode)
@@ -75,7 +82,13 @@ func getCoverage(org, repo, token string) (float64, error) {
 }
 
 func main() {
-	org := "openshift" // Set your organization name here
+	targetOpts := addTargetFlags(flag.CommandLine)
+	logOpts := addLogFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatal(err)
+	}
 
 	// Get GitHub token from environment variable.
 	githubToken := os.Getenv("GITHUB_TOKEN")
@@ -96,27 +109,24 @@ func main() {
 	tc := oauth2.NewClient(ctx, ts)
 	ghClient := github.NewClient(tc)
 
-	// List repositories for the organization.
-	repos, _, err := ghClient.Repositories.ListByOrg(ctx, org, nil)
+	// List the repositories of the configured orgs, or the configured repo list.
+	targets, err := targetOpts.resolve(ctx, ghClient)
 	if err != nil {
 		log.Fatalf("Error listing repositories: %v", err)
 	}
 
-	// Debugging: Print all retrieved repository names
-	fmt.Println("[DEBUG] Retrieved repositories from GitHub:")
-	for _, repo := range repos {
-		fmt.Printf("- %s\n", repo.GetName())
+	for _, target := range targets {
+		slog.Debug("Retrieved repository", "org", target.Org, "repo", target.Name)
 	}
 
 	// Iterate over each repository.
-	for _, repo := range repos {
-		repoName := repo.GetName()
-		fmt.Printf("\n[INFO] Processing repository: %s\n", repoName)
-		coverage, err := getCoverage(org, repoName, codecovToken)
+	for _, target := range targets {
+		slog.Info("Processing repository", "org", target.Org, "repo", target.Name, "branch", target.Branch)
+		coverage, err := getCoverage(target.Org, target.Name, target.Branch, codecovToken)
 		if err != nil {
-			fmt.Printf("[ERROR] Repo: %s, error getting coverage: %v\n", repoName, err)
+			slog.Error("Error getting coverage", "org", target.Org, "repo", target.Name, "error", err)
 		} else {
-			fmt.Printf("[SUCCESS] Repo: %s, Test Coverage: %.2f%%\n", repoName, coverage)
+			slog.Info("Test coverage", "org", target.Org, "repo", target.Name, "coverage", fmt.Sprintf("%.2f%%", coverage))
 		}
 	}
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reporter renders coverage results in one output format
+type Reporter interface {
+	// Ext is the file extension used for detailed reports in this format
+	Ext() string
+	// Summary renders the coverage list of the scanned orgs; results are already sorted
+	Summary(w io.Writer, orgs string, results []RepoCoverage) error
+	// Detailed renders the per-file coverage report of one repo
+	Detailed(w io.Writer, repo string, report *CodecovReport) error
+}
+
+// newReporter returns the reporter for a --format value
+func newReporter(format string) (Reporter, error) {
+	switch format {
+	case "text":
+		return textReporter{}, nil
+	case "csv":
+		return csvReporter{}, nil
+	case "json":
+		return jsonReporter{}, nil
+	case "markdown", "md":
+		return markdownReporter{}, nil
+	case "html":
+		return htmlReporter{}, nil
+	}
+	return nil, fmt.Errorf("unknown report format %q (want text, csv, json, markdown or html)", format)
+}
+
+// generateDetailedReport writes the detailed report of a repo to a file in dir
+func generateDetailedReport(reporter Reporter, dir string, repo RepoCoverage, report *CodecovReport) (string, error) {
+	filename := filepath.Join(dir, fmt.Sprintf("detailed_%s_%s_coverage_report.%s", repo.Org, repo.Name, reporter.Ext()))
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Sort files by lowest coverage (ascending order)
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Totals.Coverage < report.Files[j].Totals.Coverage
+	})
+
+	if err := reporter.Detailed(file, repo.FullName(), report); err != nil {
+		return "", err
+	}
+	return filename, file.Close()
+}
+
+// formatCoverage returns the coverage percentage, or an empty string when there is none
+func formatCoverage(repo RepoCoverage) string {
+	if !repo.Status.HasCoverage() {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", repo.Coverage)
+}
+
+// formatRawCoverage returns the coverage before ignored files were excluded, or an empty
+// string when coverage was not recomputed
+func formatRawCoverage(repo RepoCoverage) string {
+	if repo.RawCoverage == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *repo.RawCoverage)
+}
+
+// anyAdjusted reports whether coverage of any result was recomputed without ignored files
+func anyAdjusted(results []RepoCoverage) bool {
+	for _, repo := range results {
+		if repo.RawCoverage != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// errorMessage returns the underlying error of a result, if any
+func errorMessage(repo RepoCoverage) string {
+	if repo.Err == nil {
+		return ""
+	}
+	return repo.Err.Error()
+}
+
+// textReporter keeps the original "Repository, Coverage Percentage" output
+type textReporter struct{}
+
+func (textReporter) Ext() string { return "csv" }
+
+func (textReporter) Summary(w io.Writer, orgs string, results []RepoCoverage) error {
+	fmt.Fprintln(w, "Repository, Coverage Percentage")
+	for _, repo := range results {
+		if repo.Status.HasCoverage() && repo.RawCoverage != nil {
+			fmt.Fprintf(w, "%s, %.2f%% (raw %.2f%%)\n", repo.FullName(), repo.Coverage, *repo.RawCoverage)
+		} else if repo.Status.HasCoverage() {
+			fmt.Fprintf(w, "%s, %.2f%%\n", repo.FullName(), repo.Coverage)
+		} else {
+			fmt.Fprintf(w, "%s, %s\n", repo.FullName(), repo.Status)
+		}
+	}
+	return nil
+}
+
+// detailed reports have always been CSV files
+func (textReporter) Detailed(w io.Writer, repo string, report *CodecovReport) error {
+	return csvReporter{}.Detailed(w, repo, report)
+}
+
+// csvReporter writes RFC 4180 CSV
+type csvReporter struct{}
+
+func (csvReporter) Ext() string { return "csv" }
+
+func (csvReporter) Summary(w io.Writer, orgs string, results []RepoCoverage) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Organization", "Repository", "Branch", "Coverage %", "Status", "Error", "Raw Coverage %"})
+	for _, repo := range results {
+		writer.Write([]string{repo.Org, repo.Name, repo.Branch, formatCoverage(repo), repo.Status.String(), errorMessage(repo), formatRawCoverage(repo)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (csvReporter) Detailed(w io.Writer, repo string, report *CodecovReport) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"File", "Total Lines", "Covered Lines", "Missed Lines", "Coverage %"})
+	for _, file := range report.Files {
+		writer.Write([]string{
+			file.Name,
+			fmt.Sprintf("%d", file.Totals.Lines),
+			fmt.Sprintf("%d", file.Totals.Hits),
+			fmt.Sprintf("%d", file.Totals.Misses),
+			fmt.Sprintf("%.2f", file.Totals.Coverage),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// jsonReporter writes indented JSON documents
+type jsonReporter struct{}
+
+// jsonRepo is the JSON form of a RepoCoverage
+type jsonRepo struct {
+	Org      string         `json:"org"`
+	Name     string         `json:"name"`
+	Branch   string         `json:"branch,omitempty"`
+	Commit   string         `json:"commit,omitempty"`
+	Coverage *float64       `json:"coverage"`
+	Raw      *float64       `json:"raw_coverage,omitempty"`
+	Status   CoverageStatus `json:"status"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func (jsonReporter) Ext() string { return "json" }
+
+func (jsonReporter) Summary(w io.Writer, orgs string, results []RepoCoverage) error {
+	repos := make([]jsonRepo, 0, len(results))
+	for _, repo := range results {
+		entry := jsonRepo{Org: repo.Org, Name: repo.Name, Branch: repo.Branch, Commit: repo.Commit, Status: repo.Status, Error: errorMessage(repo)}
+		if repo.Status.HasCoverage() {
+			coverage := repo.Coverage
+			entry.Coverage = &coverage
+			entry.Raw = repo.RawCoverage
+		}
+		repos = append(repos, entry)
+	}
+	return writeJSON(w, struct {
+		Repositories []jsonRepo `json:"repositories"`
+	}{repos})
+}
+
+func (jsonReporter) Detailed(w io.Writer, repo string, report *CodecovReport) error {
+	return writeJSON(w, struct {
+		Repository string         `json:"repository"`
+		Coverage   float64        `json:"coverage"`
+		Files      []FileCoverage `json:"files"`
+	}{repo, report.Totals.Coverage, report.Files})
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// markdownReporter writes GitHub-flavoured Markdown tables
+type markdownReporter struct{}
+
+func (markdownReporter) Ext() string { return "md" }
+
+func (markdownReporter) Summary(w io.Writer, orgs string, results []RepoCoverage) error {
+	fmt.Fprintf(w, "## Coverage for %s\n\n", markdownEscape(orgs))
+	adjusted := anyAdjusted(results)
+	if adjusted {
+		fmt.Fprintln(w, "| Repository | Coverage | Raw Coverage | Status |")
+		fmt.Fprintln(w, "|---|---:|---:|---|")
+	} else {
+		fmt.Fprintln(w, "| Repository | Coverage | Status |")
+		fmt.Fprintln(w, "|---|---:|---|")
+	}
+	for _, repo := range results {
+		coverage := formatCoverage(repo)
+		if coverage != "" {
+			coverage += "%"
+		}
+		if adjusted {
+			raw := formatRawCoverage(repo)
+			if raw != "" {
+				raw += "%"
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", markdownEscape(repo.FullName()), coverage, raw, repo.Status)
+			continue
+		}
+		fmt.Fprintf(w, "| %s | %s | %s |\n", markdownEscape(repo.FullName()), coverage, repo.Status)
+	}
+	return nil
+}
+
+func (markdownReporter) Detailed(w io.Writer, repo string, report *CodecovReport) error {
+	fmt.Fprintf(w, "## Coverage for %s: %.2f%%\n\n", markdownEscape(repo), report.Totals.Coverage)
+	fmt.Fprintln(w, "| File | Total Lines | Covered Lines | Missed Lines | Coverage |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|")
+	for _, file := range report.Files {
+		fmt.Fprintf(w, "| `%s` | %d | %d | %d | %.2f%% |\n", strings.ReplaceAll(file.Name, "|", "\\|"),
+			file.Totals.Lines, file.Totals.Hits, file.Totals.Misses, file.Totals.Coverage)
+	}
+	return nil
+}
+
+// markdownEscape escapes characters that would break a table cell, add formatting or
+// be read as inline HTML
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`", "<", "&lt;", ">", "&gt;", "&", "&amp;").Replace(s)
+}
+
+// htmlReporter writes self-contained HTML pages with inline styles
+type htmlReporter struct{}
+
+const htmlHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 4px 10px; }
+th { background: #f6f8fa; text-align: left; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+tr.low td { background: #ffebe9; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+`
+
+var htmlSummaryTemplate = template.Must(template.New("summary").Parse(htmlHead + `<table>
+<tr><th>Repository</th><th>Coverage</th>{{if .Adjusted}}<th>Raw Coverage</th>{{end}}<th>Status</th><th>Error</th></tr>
+{{range .Repos}}<tr{{if .Low}} class="low"{{end}}><td>{{.Name}}</td><td class="num">{{.Coverage}}</td>{{if $.Adjusted}}<td class="num">{{.Raw}}</td>{{end}}<td>{{.Status}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var htmlDetailedTemplate = template.Must(template.New("detailed").Parse(htmlHead + `<table>
+<tr><th>File</th><th>Total Lines</th><th>Covered Lines</th><th>Missed Lines</th><th>Coverage</th></tr>
+{{range .Files}}<tr{{if lt .Totals.Coverage 50.0}} class="low"{{end}}><td><code>{{.Name}}</code></td><td class="num">{{.Totals.Lines}}</td><td class="num">{{.Totals.Hits}}</td><td class="num">{{.Totals.Misses}}</td><td class="num">{{printf "%.2f%%" .Totals.Coverage}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (htmlReporter) Ext() string { return "html" }
+
+func (htmlReporter) Summary(w io.Writer, orgs string, results []RepoCoverage) error {
+	type row struct {
+		Name, Coverage, Raw, Status, Error string
+		Low                                bool
+	}
+	rows := make([]row, 0, len(results))
+	for _, repo := range results {
+		coverage := formatCoverage(repo)
+		if coverage != "" {
+			coverage += "%"
+		}
+		raw := formatRawCoverage(repo)
+		if raw != "" {
+			raw += "%"
+		}
+		rows = append(rows, row{
+			Name:     repo.FullName(),
+			Coverage: coverage,
+			Raw:      raw,
+			Status:   repo.Status.String(),
+			Error:    errorMessage(repo),
+			Low:      !repo.Status.HasCoverage() || repo.Coverage < 50,
+		})
+	}
+	return htmlSummaryTemplate.Execute(w, struct {
+		Title    string
+		Adjusted bool
+		Repos    []row
+	}{"Coverage for " + orgs, anyAdjusted(results), rows})
+}
+
+func (htmlReporter) Detailed(w io.Writer, repo string, report *CodecovReport) error {
+	return htmlDetailedTemplate.Execute(w, struct {
+		Title string
+		Files []FileCoverage
+	}{fmt.Sprintf("Coverage for %s: %.2f%%", repo, report.Totals.Coverage), report.Files})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+// checkGolden compares got to testdata/<name>, or rewrites the file with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// reportFixture returns results and a detailed report whose names hold characters each
+// format must escape
+func reportFixture() ([]RepoCoverage, *CodecovReport) {
+	raw := 78.5
+	results := []RepoCoverage{
+		{Org: "acme", Name: `api|v2,"beta"<x>&_y`, Branch: "main", Coverage: 81.234, RawCoverage: &raw, Status: StatusCovered},
+		{Org: "acme", Name: "cli", Branch: "release-1.0", Coverage: 42, Status: StatusCovered},
+		{Org: "acme", Name: "docs", Status: StatusNotConfigured},
+		{Org: "acme", Name: "web", Status: StatusTransientError, Err: errors.New(`codecov: 502 "<html>" & retry, later`)},
+	}
+
+	var report CodecovReport
+	report.Totals.Coverage = 66.67
+	for _, file := range []struct {
+		name                string
+		lines, hits, misses int
+		coverage            float64
+	}{
+		{`pkg/a|b,"c"<d>&e.go`, 10, 3, 7, 30},
+		{"pkg/main.go", 20, 18, 2, 90},
+	} {
+		f := FileCoverage{Name: file.name}
+		f.Totals.Lines, f.Totals.Hits, f.Totals.Misses, f.Totals.Coverage = file.lines, file.hits, file.misses, file.coverage
+		report.Files = append(report.Files, f)
+	}
+	return results, &report
+}
+
+func TestReporters(t *testing.T) {
+	results, report := reportFixture()
+	for _, format := range []string{"text", "csv", "json", "markdown", "html"} {
+		t.Run(format, func(t *testing.T) {
+			reporter, err := newReporter(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var summary bytes.Buffer
+			if err := reporter.Summary(&summary, "acme & <friends>", results); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join("report", format+"_summary."+reporter.Ext()), summary.Bytes())
+
+			var detailed bytes.Buffer
+			if err := reporter.Detailed(&detailed, "acme/api", report); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join("report", format+"_detailed."+reporter.Ext()), detailed.Bytes())
+		})
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	for _, format := range []string{"text", "csv", "json", "markdown", "md", "html"} {
+		if _, err := newReporter(format); err != nil {
+			t.Errorf("newReporter(%q) error = %v", format, err)
+		}
+	}
+	for _, format := range []string{"", "xml", "HTML"} {
+		if _, err := newReporter(format); err == nil {
+			t.Errorf("newReporter(%q) succeeded, want error", format)
+		}
+	}
+}
+
+func TestMarkdownEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain-name", "plain-name"},
+		{"a|b", `a\|b`},
+		{"*bold* _it_ `code`", "\\*bold\\* \\_it\\_ \\`code\\`"},
+		{"<script>&amp;", "&lt;script&gt;&amp;amp;"},
+	}
+	for _, tt := range tests {
+		if got := markdownEscape(tt.in); got != tt.want {
+			t.Errorf("markdownEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
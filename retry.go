@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// Retry settings shared by the coverage API and GitHub clients; maxRetries is set from flags in main
+var (
+	maxRetries     = 5
+	retryBaseDelay = 1 * time.Second
+	retryMaxDelay  = 60 * time.Second
+)
+
+// backoff returns the delay before retry number attempt (starting at 0), using
+// exponential backoff with full jitter
+func backoff(attempt int) time.Duration {
+	ceiling := float64(retryBaseDelay) * math.Pow(2, float64(attempt))
+	if ceiling > float64(retryMaxDelay) {
+		ceiling = float64(retryMaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// sleepContext waits for d, returning early with the context error if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfter returns how long the server asked us to wait, based on the Retry-After
+// header or, for an exhausted GitHub rate limit, the X-RateLimit-Reset header.
+// It returns false if the response carries no such hint.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return time.Until(at), true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)), true
+		}
+	}
+
+	return 0, false
+}
+
+// shouldRetry reports whether resp is a rate limit or transient server error
+func shouldRetry(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		// GitHub reports both primary and secondary rate limits as 403
+		_, limited := retryAfter(resp)
+		return limited
+	}
+	return false
+}
+
+// isIdempotent reports whether req can be sent again without repeating its effect: GET
+// and HEAD requests, and requests marked with an idempotency key as net/http does
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// retryTransport retries rate limited, failed and transient idempotent requests. It
+// waits for Retry-After or the rate limit reset when the server provides them, and backs
+// off exponentially otherwise. Other requests are sent once, since a failure may come
+// after the server applied them.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if err == nil {
+			slog.Debug("API request", "method", req.Method, "url", req.URL, "status", resp.StatusCode, "attempt", attempt)
+		}
+
+		// requests with a body can only be replayed if it can be recreated
+		canRetry := attempt < maxRetries && isIdempotent(req) && (req.Body == nil || req.GetBody != nil)
+		if !canRetry || (err == nil && !shouldRetry(resp)) {
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		if err == nil {
+			if wait, ok := retryAfter(resp); ok && wait > 0 {
+				delay = wait
+			}
+			slog.Warn("Retrying API request", "method", req.Method, "host", req.URL.Host, "status", resp.StatusCode, "delay", delay.Round(time.Second))
+			resp.Body.Close()
+		} else {
+			slog.Warn("Retrying API request", "method", req.Method, "host", req.URL.Host, "error", err, "delay", delay.Round(time.Second))
+		}
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// newAPITransport returns the base transport for API clients. Timeouts are applied per
+// attempt rather than on the http.Client, so that retry waits are not cut short.
+func newAPITransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 10 * time.Second
+	return transport
+}
+
+// withGitHubRetry calls fn until it succeeds, retrying go-github rate limit errors
+// (which go-github may return without contacting the API) and transient failures. It is
+// the only retry layer for GitHub, whose client transport does not retry, and must only
+// wrap calls that are safe to repeat.
+func withGitHubRetry(ctx context.Context, fn func() (*github.Response, error)) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := fn()
+		if err == nil || attempt >= maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var rateLimitErr *github.RateLimitError
+		var abuseErr *github.AbuseRateLimitError
+		var delay time.Duration
+		switch {
+		case errors.As(err, &rateLimitErr):
+			delay = time.Until(rateLimitErr.Rate.Reset.Time)
+		case errors.As(err, &abuseErr) && abuseErr.RetryAfter != nil:
+			delay = *abuseErr.RetryAfter
+		case errors.As(err, &abuseErr):
+			delay = backoff(attempt)
+		case resp != nil && resp.Response != nil && shouldRetry(resp.Response):
+			delay = backoff(attempt)
+			if wait, ok := retryAfter(resp.Response); ok {
+				delay = wait
+			}
+		case resp != nil && resp.Response != nil && resp.StatusCode < 500:
+			// other client errors won't go away by retrying
+			return err
+		default:
+			delay = backoff(attempt)
+		}
+
+		if delay < 0 {
+			delay = 0
+		}
+		slog.Warn("Retrying GitHub API call", "error", err, "delay", delay.Round(time.Second))
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// withGitHubWriteRetry makes a GitHub write that must not be repeated, such as creating
+// an issue. It retries like withGitHubRetry, but since a failed attempt may still have
+// been applied by GitHub, it first calls applied to look for the write's result, and
+// stops once that is found.
+func withGitHubWriteRetry(ctx context.Context, write func() (*github.Response, error), applied func() (bool, error)) error {
+	attempted := false
+	return withGitHubRetry(ctx, func() (*github.Response, error) {
+		if attempted {
+			done, err := applied()
+			if err != nil || done {
+				return nil, err
+			}
+		}
+		attempted = true
+		return write()
+	})
+}
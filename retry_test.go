@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// fastRetries shortens retry delays for the duration of a test
+func fastRetries(t *testing.T, retries int) {
+	t.Helper()
+	oldRetries, oldBase, oldMax := maxRetries, retryBaseDelay, retryMaxDelay
+	maxRetries, retryBaseDelay, retryMaxDelay = retries, time.Millisecond, time.Millisecond
+	t.Cleanup(func() { maxRetries, retryBaseDelay, retryMaxDelay = oldRetries, oldBase, oldMax })
+}
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		want   bool
+	}{
+		{"ok", http.StatusOK, nil, false},
+		{"not found", http.StatusNotFound, nil, false},
+		{"server error", http.StatusInternalServerError, nil, false},
+		{"too many requests", http.StatusTooManyRequests, nil, true},
+		{"bad gateway", http.StatusBadGateway, nil, true},
+		{"unavailable", http.StatusServiceUnavailable, nil, true},
+		{"gateway timeout", http.StatusGatewayTimeout, nil, true},
+		{"forbidden", http.StatusForbidden, nil, false},
+		{"secondary rate limit", http.StatusForbidden, map[string]string{"Retry-After": "3"}, true},
+		{"primary rate limit", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000000"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			if got := shouldRetry(resp); got != tt.want {
+				t.Errorf("shouldRetry(%d %v) = %v, want %v", tt.status, tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"no hint", nil, 0, false},
+		{"seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second, true},
+		{"date", map[string]string{"Retry-After": reset.UTC().Format(http.TimeFormat)}, 30 * time.Second, true},
+		{"rate limit reset", map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)}, 30 * time.Second, true},
+		{"remaining requests", map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			got, ok := retryAfter(resp)
+			if ok != tt.wantOK || got > tt.want || got < tt.want-2*time.Second {
+				t.Errorf("retryAfter() = %v %v, want about %v %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		header       string // request header set to mark the request idempotent
+		statuses     []int  // status of each attempt, the last one repeating
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{"success", http.MethodGet, "", []int{200}, 200, 1},
+		{"transient error", http.MethodGet, "", []int{503, 502, 200}, 200, 3},
+		{"rate limited", http.MethodHead, "", []int{429, 200}, 200, 2},
+		{"gives up", http.MethodGet, "", []int{503}, 503, 4},
+		{"client error", http.MethodGet, "", []int{404, 200}, 404, 1},
+		{"post", http.MethodPost, "", []int{502, 200}, 502, 1},
+		{"patch", http.MethodPatch, "", []int{504, 200}, 504, 1},
+		{"post with idempotency key", http.MethodPost, "Idempotency-Key", []int{502, 200}, 200, 2},
+		{"put with idempotency key", http.MethodPut, "X-Idempotency-Key", []int{503, 200}, 200, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fastRetries(t, 3)
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&attempts, 1))
+				if r.Method == http.MethodPost || r.Method == http.MethodPut {
+					// replayed requests must carry their body again
+					body, err := io.ReadAll(r.Body)
+					if err != nil || string(body) != "payload" {
+						t.Errorf("attempt %d body = %q, %v", n, body, err)
+					}
+				}
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			req, err := http.NewRequest(tt.method, server.URL, strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, "key")
+			}
+			client := &http.Client{Transport: &retryTransport{}}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus || attempts != tt.wantAttempts {
+				t.Errorf("got %d after %d attempts, want %d after %d", resp.StatusCode, attempts, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportContextCanceled(t *testing.T) {
+	fastRetries(t, 3)
+	retryBaseDelay, retryMaxDelay = time.Hour, time.Hour
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	client := &http.Client{Transport: &retryTransport{}}
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want the context deadline", err)
+	}
+}
+
+func TestWithGitHubRetry(t *testing.T) {
+	githubResponse := func(status int) *github.Response {
+		return &github.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}}
+	}
+	tests := []struct {
+		name      string
+		results   []error // error of each call, the last one repeating
+		status    int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", []error{nil}, 200, 1, false},
+		{"network error", []error{errors.New("reset"), nil}, 0, 2, false},
+		{"server error", []error{errors.New("boom"), errors.New("boom"), nil}, 500, 3, false},
+		{"too many requests", []error{errors.New("slow down"), nil}, 429, 2, false},
+		{"abuse rate limit", []error{&github.AbuseRateLimitError{Response: &http.Response{Request: &http.Request{URL: &url.URL{}}}}, nil}, 403, 2, false},
+		{"not found", []error{errors.New("missing")}, 404, 1, true},
+		{"gives up", []error{errors.New("boom")}, 502, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fastRetries(t, 3)
+			calls := 0
+			err := withGitHubRetry(context.Background(), func() (*github.Response, error) {
+				calls++
+				err := tt.results[min(calls, len(tt.results))-1]
+				if err == nil {
+					return githubResponse(200), nil
+				}
+				if tt.status == 0 {
+					return nil, err
+				}
+				return githubResponse(tt.status), err
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("withGitHubRetry() = %v after %d calls, want error %v after %d", err, calls, tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
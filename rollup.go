@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// coverageNode is a directory (or file) in a coverage rollup tree, with line-weighted
+// totals of everything below it
+type coverageNode struct {
+	Name     string
+	Path     string // slash-separated path from the repo root, empty for the root
+	IsFile   bool
+	Files    int
+	Lines    int
+	Hits     int
+	Misses   int
+	Children []*coverageNode
+}
+
+// Coverage returns the percentage of lines hit below the node
+func (n *coverageNode) Coverage() float64 {
+	if n.Lines == 0 {
+		return 0
+	}
+	return float64(n.Hits) / float64(n.Lines) * 100
+}
+
+// child returns the child called name, creating it if needed
+func (n *coverageNode) child(name string) *coverageNode {
+	for _, c := range n.Children {
+		if c.Name == name && !c.IsFile {
+			return c
+		}
+	}
+	path := name
+	if n.Path != "" {
+		path = n.Path + "/" + name
+	}
+	c := &coverageNode{Name: name, Path: path}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// buildRollup aggregates per-file coverage into a directory tree rooted at repo. File
+// leaves are only kept with includeFiles; their lines always count towards directories.
+func buildRollup(repo string, files []FileCoverage, includeFiles bool) *coverageNode {
+	root := &coverageNode{Name: repo}
+	for _, file := range files {
+		parts := strings.Split(strings.Trim(file.Name, "/"), "/")
+		dirs := parts[:len(parts)-1]
+
+		node := root
+		nodes := []*coverageNode{root}
+		for _, dir := range dirs {
+			node = node.child(dir)
+			nodes = append(nodes, node)
+		}
+		for _, n := range nodes {
+			n.Files++
+			n.Lines += file.Totals.Lines
+			n.Hits += file.Totals.Hits
+			n.Misses += file.Totals.Misses
+		}
+
+		if includeFiles {
+			node.Children = append(node.Children, &coverageNode{
+				Name:   parts[len(parts)-1],
+				Path:   file.Name,
+				IsFile: true,
+				Files:  1,
+				Lines:  file.Totals.Lines,
+				Hits:   file.Totals.Hits,
+				Misses: file.Totals.Misses,
+			})
+		}
+	}
+	return root
+}
+
+// sortRollup orders the children of every node by coverage (lowest first, so packages
+// dragging coverage down come first) or by name
+func sortRollup(n *coverageNode, byCoverage bool) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if byCoverage && a.Coverage() != b.Coverage() {
+			return a.Coverage() < b.Coverage()
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range n.Children {
+		sortRollup(c, byCoverage)
+	}
+}
+
+// walkRollup calls fn for every node in depth-first order, down to maxDepth levels
+// below the root (0 for no limit)
+func walkRollup(n *coverageNode, depth, maxDepth int, fn func(n *coverageNode, depth int)) {
+	fn(n, depth)
+	if maxDepth > 0 && depth >= maxDepth {
+		return
+	}
+	for _, c := range n.Children {
+		walkRollup(c, depth+1, maxDepth, fn)
+	}
+}
+
+// runRollup implements the "rollup" command, printing per-directory coverage of a repo
+func runRollup(args []string) int {
+	fs := flag.NewFlagSet("rollup", flag.ExitOnError)
+	repoFlag := fs.String("repo", "", "Repository to roll up, as org/repo")
+	ref := fs.String("ref", "", "SHA, branch or tag to read coverage for (default: the default branch HEAD)")
+	format := fs.String("format", "text", "Output format: text, csv or json")
+	output := fs.String("output", "", "Write the rollup to this file instead of stdout")
+	depth := fs.Int("depth", 0, "Only show this many directory levels (0 for all)")
+	includeFiles := fs.Bool("files", false, "Also list files under their directories")
+	sortBy := fs.String("sort", "coverage", "Order of entries within a directory: coverage (lowest first) or name")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if *repoFlag == "" {
+		log.Fatal("❌ Please set -repo")
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		log.Fatalf("❌ unknown rollup format %q (want text, csv or json)", *format)
+	}
+	if *sortBy != "coverage" && *sortBy != "name" {
+		log.Fatalf("❌ unknown -sort %q (want coverage or name)", *sortBy)
+	}
+
+	org, repo, ok := strings.Cut(*repoFlag, "/")
+	if !ok {
+		org, repo = defaultOrg, *repoFlag
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+	codecovToken := os.Getenv("CODECOV_TOKEN")
+	if codecovToken == "" {
+		log.Fatal("❌ Please set the CODECOV_TOKEN environment variable")
+	}
+
+	headRef := *ref
+	if headRef == "" {
+		headRef = "HEAD"
+	}
+	sha, err := resolveRef(context.Background(), newGitHubClient(githubToken), org, repo, headRef)
+	if err != nil {
+		log.Fatalf("❌ Error resolving %s: %v", headRef, err)
+	}
+	report, err := getDetailedCoverageReport(org, repo, "", sha, codecovToken)
+	if err != nil {
+		log.Fatalf("❌ Error getting coverage of %s: %v", headRef, err)
+	}
+
+	root := buildRollup(org+"/"+repo, report.Files, *includeFiles)
+	sortRollup(root, *sortBy == "coverage")
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatalf("❌ Error creating %s: %v", *output, err)
+		}
+	}
+
+	switch *format {
+	case "csv":
+		err = writeRollupCSV(out, root, *depth)
+	case "json":
+		err = writeRollupJSON(out, root, *depth)
+	default:
+		err = writeRollupText(out, root, *depth)
+	}
+	if err != nil {
+		log.Fatalf("❌ Error writing rollup: %v", err)
+	}
+
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("❌ Error writing rollup: %v", err)
+		}
+	}
+	return exitOK
+}
+
+func writeRollupText(w io.Writer, root *coverageNode, maxDepth int) error {
+	walkRollup(root, 0, maxDepth, func(n *coverageNode, depth int) {
+		name := n.Name
+		if !n.IsFile && depth > 0 {
+			name += "/"
+		}
+		fmt.Fprintf(w, "%s%s %.2f%% (%d/%d lines, %d files)\n", strings.Repeat("  ", depth), name, n.Coverage(), n.Hits, n.Lines, n.Files)
+	})
+	return nil
+}
+
+func writeRollupCSV(w io.Writer, root *coverageNode, maxDepth int) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Path", "Type", "Depth", "Files", "Total Lines", "Covered Lines", "Missed Lines", "Coverage %"})
+	walkRollup(root, 0, maxDepth, func(n *coverageNode, depth int) {
+		kind := "directory"
+		if n.IsFile {
+			kind = "file"
+		}
+		path := n.Path
+		if depth == 0 {
+			path = "."
+		}
+		writer.Write([]string{
+			path,
+			kind,
+			fmt.Sprintf("%d", depth),
+			fmt.Sprintf("%d", n.Files),
+			fmt.Sprintf("%d", n.Lines),
+			fmt.Sprintf("%d", n.Hits),
+			fmt.Sprintf("%d", n.Misses),
+			fmt.Sprintf("%.2f", n.Coverage()),
+		})
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// jsonNode is the JSON form of a coverageNode
+type jsonNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	Files    int         `json:"files"`
+	Lines    int         `json:"lines"`
+	Hits     int         `json:"hits"`
+	Misses   int         `json:"misses"`
+	Coverage float64     `json:"coverage"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+func toJSONNode(n *coverageNode, depth, maxDepth int) *jsonNode {
+	node := &jsonNode{Name: n.Name, Path: n.Path, Type: "directory", Files: n.Files, Lines: n.Lines, Hits: n.Hits, Misses: n.Misses, Coverage: n.Coverage()}
+	if n.IsFile {
+		node.Type = "file"
+	}
+	if maxDepth > 0 && depth >= maxDepth {
+		return node
+	}
+	for _, c := range n.Children {
+		node.Children = append(node.Children, toJSONNode(c, depth+1, maxDepth))
+	}
+	return node
+}
+
+func writeRollupJSON(w io.Writer, root *coverageNode, maxDepth int) error {
+	return writeJSON(w, toJSONNode(root, 0, maxDepth))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// rollupFiles returns per-file coverage for "name lines hits" entries
+func rollupFiles(entries ...interface{}) []FileCoverage {
+	var files []FileCoverage
+	for i := 0; i < len(entries); i += 3 {
+		file := FileCoverage{Name: entries[i].(string)}
+		file.Totals.Lines, file.Totals.Hits = entries[i+1].(int), entries[i+2].(int)
+		file.Totals.Misses = file.Totals.Lines - file.Totals.Hits
+		if file.Totals.Lines > 0 {
+			file.Totals.Coverage = float64(file.Totals.Hits) / float64(file.Totals.Lines) * 100
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// describeRollup flattens a rollup into "path: files lines/hits coverage" lines, in
+// name order
+func describeRollup(root *coverageNode) []string {
+	sortRollup(root, false)
+	var lines []string
+	walkRollup(root, 0, 0, func(n *coverageNode, depth int) {
+		kind := "dir"
+		if n.IsFile {
+			kind = "file"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %d files %d/%d %.2f%%", kind, n.Path, n.Files, n.Hits, n.Lines, n.Coverage()))
+	})
+	return lines
+}
+
+func TestBuildRollup(t *testing.T) {
+	files := rollupFiles(
+		"main.go", 10, 10,
+		"pkg/a/a.go", 100, 90,
+		"pkg/a/b.go", 10, 0,
+		"pkg/c/deep/d.go", 50, 25,
+		"empty/gen.go", 0, 0,
+	)
+
+	tests := []struct {
+		name         string
+		includeFiles bool
+		want         []string
+	}{
+		{
+			name: "directories only",
+			want: []string{
+				// 125/170 lines, not the 59% average of the file percentages
+				"dir : 5 files 125/170 73.53%",
+				"dir empty: 1 files 0/0 0.00%",
+				"dir pkg: 3 files 115/160 71.88%",
+				"dir pkg/a: 2 files 90/110 81.82%",
+				"dir pkg/c: 1 files 25/50 50.00%",
+				"dir pkg/c/deep: 1 files 25/50 50.00%",
+			},
+		},
+		{
+			name:         "with files",
+			includeFiles: true,
+			want: []string{
+				"dir : 5 files 125/170 73.53%",
+				"dir empty: 1 files 0/0 0.00%",
+				"file empty/gen.go: 1 files 0/0 0.00%",
+				"file main.go: 1 files 10/10 100.00%",
+				"dir pkg: 3 files 115/160 71.88%",
+				"dir pkg/a: 2 files 90/110 81.82%",
+				"file pkg/a/a.go: 1 files 90/100 90.00%",
+				"file pkg/a/b.go: 1 files 0/10 0.00%",
+				"dir pkg/c: 1 files 25/50 50.00%",
+				"dir pkg/c/deep: 1 files 25/50 50.00%",
+				"file pkg/c/deep/d.go: 1 files 25/50 50.00%",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := buildRollup("acme/api", files, tt.includeFiles)
+			if root.Name != "acme/api" {
+				t.Errorf("root name = %q, want acme/api", root.Name)
+			}
+			if got := describeRollup(root); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rollup =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkRollupDepth(t *testing.T) {
+	root := buildRollup("acme/api", rollupFiles("pkg/a/b/c.go", 10, 5), false)
+	var paths []string
+	walkRollup(root, 0, 2, func(n *coverageNode, depth int) {
+		paths = append(paths, fmt.Sprintf("%d:%s", depth, n.Path))
+	})
+	if want := []string{"0:", "1:pkg", "2:pkg/a"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("walkRollup() visited %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// coverageMetrics holds the gauges exported by the serve command
+type coverageMetrics struct {
+	coverage     *prometheus.GaugeVec
+	configured   *prometheus.GaugeVec
+	status       *prometheus.GaugeVec
+	fileCoverage *prometheus.GaugeVec
+
+	scrapeSuccess     prometheus.Gauge
+	scrapeDuration    prometheus.Gauge
+	scrapeLastSuccess prometheus.Gauge
+	scrapeFailures    prometheus.Counter
+	scrapeRepos       *prometheus.GaugeVec
+	scrapeRepoErrors  *prometheus.GaugeVec
+
+	// label sets of each vec written by the last and the running update
+	exported map[*prometheus.GaugeVec]map[string][]string
+	written  map[*prometheus.GaugeVec]map[string][]string
+}
+
+func newCoverageMetrics(reg *prometheus.Registry) *coverageMetrics {
+	m := &coverageMetrics{
+		coverage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "repo_coverage_percent",
+			Help: "Latest coverage percentage of the repository.",
+		}, []string{"org", "repo"}),
+		configured: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "repo_coverage_configured",
+			Help: "1 if the repository reports coverage to its provider, 0 otherwise.",
+		}, []string{"org", "repo"}),
+		status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "repo_coverage_status",
+			Help: "1 for the current coverage status of the repository.",
+		}, []string{"org", "repo", "status"}),
+		fileCoverage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "repo_file_coverage_percent",
+			Help: "Coverage percentage of a file in the repository, only exported with -per-file.",
+		}, []string{"org", "repo", "file"}),
+		scrapeSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "coverage_scrape_success",
+			Help: "1 if the last coverage collection succeeded.",
+		}),
+		scrapeDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "coverage_scrape_duration_seconds",
+			Help: "Duration of the last coverage collection.",
+		}),
+		scrapeLastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "coverage_scrape_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful coverage collection.",
+		}),
+		scrapeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "coverage_scrape_failures_total",
+			Help: "Number of coverage collections that failed to list repositories.",
+		}),
+		scrapeRepos: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "coverage_scrape_repos",
+			Help: "Number of repositories of the org in the last coverage collection.",
+		}, []string{"org"}),
+		scrapeRepoErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "coverage_scrape_repo_errors",
+			Help: "Number of repositories of the org whose coverage could not be fetched in the last collection.",
+		}, []string{"org"}),
+	}
+
+	m.exported = map[*prometheus.GaugeVec]map[string][]string{}
+	reg.MustRegister(m.coverage, m.configured, m.status, m.fileCoverage,
+		m.scrapeSuccess, m.scrapeDuration, m.scrapeLastSuccess, m.scrapeFailures, m.scrapeRepos, m.scrapeRepoErrors)
+	return m
+}
+
+// update sets the per-repo gauges to the results of a collection. Series are updated in
+// place so that a scrape during the update still sees every repo, and only then are
+// series of repos which disappeared from the org, or changed status, deleted. Repos whose
+// coverage could not be fetched keep their last series and only count as errors, so a
+// failing API doesn't look like a drop in coverage.
+func (m *coverageMetrics) update(results []repoResult) {
+	m.written = map[*prometheus.GaugeVec]map[string][]string{}
+
+	repos := map[string]int{}
+	repoErrors := map[string]int{}
+	for _, result := range results {
+		repo := result.Coverage
+		org := repo.Org
+		repos[org]++
+		if repo.Status.IsError() {
+			repoErrors[org]++
+			m.keep(org, repo.Name, m.coverage, m.configured, m.status, m.fileCoverage)
+			continue
+		}
+
+		configured := 0.0
+		if repo.Status.HasCoverage() || repo.Status == StatusNoUploads {
+			configured = 1
+		}
+		m.set(m.configured, configured, org, repo.Name)
+		m.set(m.status, 1, org, repo.Name, repo.Status.String())
+
+		if repo.Status.HasCoverage() {
+			m.set(m.coverage, repo.Coverage, org, repo.Name)
+		}
+
+		if result.Report != nil {
+			for _, file := range result.Report.Files {
+				m.set(m.fileCoverage, file.Totals.Coverage, org, repo.Name, file.Name)
+			}
+		}
+	}
+
+	for org, count := range repos {
+		m.set(m.scrapeRepos, float64(count), org)
+		m.set(m.scrapeRepoErrors, float64(repoErrors[org]), org)
+	}
+
+	m.deleteStale(m.coverage, m.configured, m.status, m.fileCoverage, m.scrapeRepos, m.scrapeRepoErrors)
+}
+
+// set sets the gauge of vec with the given label values, recording them as written by
+// the running update
+func (m *coverageMetrics) set(vec *prometheus.GaugeVec, value float64, labels ...string) {
+	vec.WithLabelValues(labels...).Set(value)
+	if m.written[vec] == nil {
+		m.written[vec] = map[string][]string{}
+	}
+	m.written[vec][strings.Join(labels, "\xff")] = labels
+}
+
+// keep records the series of vecs exported by the last update for the repo as written by
+// the running one, so they survive it unchanged. The org and repo must be the first labels.
+func (m *coverageMetrics) keep(org, repo string, vecs ...*prometheus.GaugeVec) {
+	for _, vec := range vecs {
+		for key, labels := range m.exported[vec] {
+			if labels[0] != org || labels[1] != repo {
+				continue
+			}
+			if m.written[vec] == nil {
+				m.written[vec] = map[string][]string{}
+			}
+			m.written[vec][key] = labels
+		}
+	}
+}
+
+// deleteStale deletes the series of vecs exported by the last update but not written
+// by the running one
+func (m *coverageMetrics) deleteStale(vecs ...*prometheus.GaugeVec) {
+	for _, vec := range vecs {
+		for key, labels := range m.exported[vec] {
+			if _, ok := m.written[vec][key]; !ok {
+				vec.DeleteLabelValues(labels...)
+			}
+		}
+		m.exported[vec] = m.written[vec]
+	}
+}
+
+// runServe implements the "serve" command, which periodically collects org coverage
+// and exports it as Prometheus metrics. It only returns if the HTTP server fails.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	targetOpts := addTargetFlags(fs)
+	collect := addCollectFlags(fs)
+	listen := fs.String("listen", ":9090", "Address to serve /metrics on")
+	interval := fs.Duration("interval", time.Hour, "Time between coverage collections")
+	perFile := fs.Bool("per-file", false, "Also export per-file coverage (one series per file)")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if *interval <= 0 {
+		log.Fatal("❌ -interval must be positive")
+	}
+
+	githubToken := os.Getenv("GITHUB_TOKEN")
+	if githubToken == "" {
+		log.Fatal("❌ Please set the GITHUB_TOKEN environment variable")
+	}
+
+	providers, err := collect.providers()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	ghClient := newGitHubClient(githubToken)
+
+	reg := prometheus.NewRegistry()
+	metrics := newCoverageMetrics(reg)
+
+	// collection stops once the server fails
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			start := time.Now()
+			// resolve targets every time so new repos are picked up
+			targets, err := targetOpts.resolve(ctx, ghClient)
+			if err != nil {
+				slog.Error("Error getting repositories", "error", err)
+				metrics.scrapeSuccess.Set(0)
+				metrics.scrapeFailures.Inc()
+			} else {
+				results := collectCoverage(collect.headClient(ghClient), targets, providers, *perFile, collect.concurrency)
+				metrics.update(results)
+				metrics.scrapeSuccess.Set(1)
+				metrics.scrapeLastSuccess.SetToCurrentTime()
+				slog.Info("Collected coverage", "repos", len(results), "duration", time.Since(start).Round(time.Second))
+			}
+			metrics.scrapeDuration.Set(time.Since(start).Seconds())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	slog.Info("Serving metrics", "address", *listen, "path", "/metrics")
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		slog.Error("Metrics server failed", "error", err)
+	}
+	return 1
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// gatherSeries returns the series of the named metric as sorted "label=value,...: gauge" strings
+func gatherSeries(t *testing.T, reg *prometheus.Registry, name string) []string {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var series []string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			series = append(series, strings.Join(labels, ",")+": "+strconv.FormatFloat(metric.GetGauge().GetValue(), 'g', -1, 64))
+		}
+	}
+	sort.Strings(series)
+	return series
+}
+
+func TestCoverageMetricsUpdate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCoverageMetrics(reg)
+
+	report := &CodecovReport{Files: []FileCoverage{{Name: "a.go"}}}
+	m.update([]repoResult{
+		{Coverage: RepoCoverage{Org: "myorg", Name: "kept", Coverage: 80, Status: StatusCovered}, Report: report},
+		{Coverage: RepoCoverage{Org: "myorg", Name: "removed", Coverage: 50, Status: StatusCovered}},
+	})
+	m.update([]repoResult{
+		{Coverage: RepoCoverage{Org: "myorg", Name: "kept", Status: StatusNoUploads}},
+		{Coverage: RepoCoverage{Org: "other", Name: "added", Status: StatusTransientError}},
+	})
+
+	tests := []struct {
+		metric string
+		want   []string
+	}{
+		{"repo_coverage_percent", nil},
+		{"repo_file_coverage_percent", nil},
+		// errors only count in coverage_scrape_repo_errors
+		{"repo_coverage_configured", []string{"org=myorg,repo=kept: 1"}},
+		{"repo_coverage_status", []string{"org=myorg,repo=kept,status=No Uploads: 1"}},
+		{"coverage_scrape_repos", []string{"org=myorg: 1", "org=other: 1"}},
+		{"coverage_scrape_repo_errors", []string{"org=myorg: 0", "org=other: 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			if got := gatherSeries(t, reg, tt.metric); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("series = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoverageMetricsUpdateKeepsSeriesOnError(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newCoverageMetrics(reg)
+
+	file := FileCoverage{Name: "a.go"}
+	file.Totals.Coverage = 60
+	report := &CodecovReport{Files: []FileCoverage{file}}
+	m.update([]repoResult{
+		{Coverage: RepoCoverage{Org: "myorg", Name: "flaky", Coverage: 80, Status: StatusCovered}, Report: report},
+		{Coverage: RepoCoverage{Org: "myorg", Name: "steady", Coverage: 70, Status: StatusCovered}},
+	})
+	for _, status := range []CoverageStatus{StatusTransientError, StatusAuthError} {
+		m.update([]repoResult{
+			{Coverage: RepoCoverage{Org: "myorg", Name: "flaky", Status: status}},
+			{Coverage: RepoCoverage{Org: "myorg", Name: "steady", Coverage: 75, Status: StatusCovered}},
+		})
+	}
+
+	tests := []struct {
+		name string
+		vec  prometheus.Collector
+		want string
+	}{
+		{"repo_coverage_percent", m.coverage, `
+# HELP repo_coverage_percent Latest coverage percentage of the repository.
+# TYPE repo_coverage_percent gauge
+repo_coverage_percent{org="myorg",repo="flaky"} 80
+repo_coverage_percent{org="myorg",repo="steady"} 75
+`},
+		{"repo_coverage_configured", m.configured, `
+# HELP repo_coverage_configured 1 if the repository reports coverage to its provider, 0 otherwise.
+# TYPE repo_coverage_configured gauge
+repo_coverage_configured{org="myorg",repo="flaky"} 1
+repo_coverage_configured{org="myorg",repo="steady"} 1
+`},
+		{"repo_coverage_status", m.status, `
+# HELP repo_coverage_status 1 for the current coverage status of the repository.
+# TYPE repo_coverage_status gauge
+repo_coverage_status{org="myorg",repo="flaky",status="Covered"} 1
+repo_coverage_status{org="myorg",repo="steady",status="Covered"} 1
+`},
+		{"repo_file_coverage_percent", m.fileCoverage, `
+# HELP repo_file_coverage_percent Coverage percentage of a file in the repository, only exported with -per-file.
+# TYPE repo_file_coverage_percent gauge
+repo_file_coverage_percent{file="a.go",org="myorg",repo="flaky"} 60
+`},
+		{"coverage_scrape_repo_errors", m.scrapeRepoErrors, `
+# HELP coverage_scrape_repo_errors Number of repositories of the org whose coverage could not be fetched in the last collection.
+# TYPE coverage_scrape_repo_errors gauge
+coverage_scrape_repo_errors{org="myorg"} 1
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testutil.CollectAndCompare(tt.vec, strings.NewReader(tt.want)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// SonarCloud URL, used when SONAR_HOST_URL is not set
+const sonarCloudURL = "https://sonarcloud.io"
+
+// sonarqubeProvider reads coverage measures from a SonarQube or SonarCloud server
+type sonarqubeProvider struct {
+	host  string
+	token string
+}
+
+// sonarMeasure is a single metric value as returned by the measures API
+type sonarMeasure struct {
+	Metric string `json:"metric"`
+	Value  string `json:"value"`
+}
+
+func (p *sonarqubeProvider) Name() string { return "sonarqube" }
+
+// projectKey follows the key SonarCloud assigns to projects imported from GitHub
+func (p *sonarqubeProvider) projectKey(org, repo string) string {
+	return org + "_" + repo
+}
+
+// get issues an authenticated GET against the SonarQube web API and decodes the JSON response
+func (p *sonarqubeProvider) get(path string, query url.Values, out interface{}) error {
+	req, _ := http.NewRequest("GET", p.host+path+"?"+query.Encode(), nil)
+	req.SetBasicAuth(p.token, "")
+
+	resp, err := providerHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &APIError{Service: "sonarqube", StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Fetch the project coverage measure for a repository. SonarQube keeps the last analysis
+// of each branch only, so sha is not used.
+func (p *sonarqubeProvider) RepoCoverage(org, repo, branch, sha string) RepoCoverage {
+	query := url.Values{}
+	query.Set("component", p.projectKey(org, repo))
+	query.Set("metricKeys", "coverage")
+	if branch != "" {
+		query.Set("branch", branch)
+	}
+
+	var data struct {
+		Component struct {
+			Measures []sonarMeasure `json:"measures"`
+		} `json:"component"`
+	}
+	if err := p.get("/api/measures/component", query, &data); err != nil {
+		return errorResult(repo, err)
+	}
+
+	// projects without an analysis that imported coverage have no measure
+	coverage, ok := sonarMeasureValue(data.Component.Measures, "coverage")
+	if !ok {
+		return RepoCoverage{Name: repo, Status: StatusNoUploads}
+	}
+	return coverageResult(repo, coverage)
+}
+
+// Fetch per-file coverage measures, one page at a time
+func (p *sonarqubeProvider) DetailedReport(org, repo, branch, sha string) (*CodecovReport, error) {
+	coverage := p.RepoCoverage(org, repo, branch, sha)
+	if coverage.Err != nil {
+		return nil, coverage.Err
+	}
+	report := &CodecovReport{}
+	report.Totals.Coverage = coverage.Coverage
+
+	query := url.Values{}
+	query.Set("component", p.projectKey(org, repo))
+	query.Set("metricKeys", "coverage,lines_to_cover,uncovered_lines")
+	query.Set("qualifiers", "FIL")
+	query.Set("ps", "500")
+	if branch != "" {
+		query.Set("branch", branch)
+	}
+
+	for page := 1; ; page++ {
+		query.Set("p", strconv.Itoa(page))
+
+		var data struct {
+			Paging struct {
+				PageIndex int `json:"pageIndex"`
+				PageSize  int `json:"pageSize"`
+				Total     int `json:"total"`
+			} `json:"paging"`
+			Components []struct {
+				Path     string         `json:"path"`
+				Measures []sonarMeasure `json:"measures"`
+			} `json:"components"`
+		}
+		if err := p.get("/api/measures/component_tree", query, &data); err != nil {
+			return nil, fmt.Errorf("failed to fetch detailed report for %s: %w", repo, err)
+		}
+
+		for _, component := range data.Components {
+			var file FileCoverage
+			file.Name = component.Path
+			lines, _ := sonarMeasureValue(component.Measures, "lines_to_cover")
+			misses, _ := sonarMeasureValue(component.Measures, "uncovered_lines")
+			file.Totals.Lines = int(lines)
+			file.Totals.Misses = int(misses)
+			file.Totals.Hits = file.Totals.Lines - file.Totals.Misses
+			file.Totals.Coverage, _ = sonarMeasureValue(component.Measures, "coverage")
+			report.Files = append(report.Files, file)
+		}
+
+		if len(data.Components) == 0 || data.Paging.PageIndex*data.Paging.PageSize >= data.Paging.Total {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// sonarMeasureValue returns the numeric value of metric, and false if it is missing
+func sonarMeasureValue(measures []sonarMeasure, metric string) (float64, bool) {
+	for _, m := range measures {
+		if m.Metric == metric {
+			v, err := strconv.ParseFloat(m.Value, 64)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
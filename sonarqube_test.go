@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSonarqubeProviderRepoCoverage(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		wantStatus   CoverageStatus
+		wantCoverage float64
+	}{
+		{
+			name: "analysed project",
+			handler: serveJSON(t, http.StatusOK, map[string]interface{}{
+				"component": map[string]interface{}{"measures": []sonarMeasure{{Metric: "coverage", Value: "72.4"}}},
+			}),
+			wantStatus:   StatusCovered,
+			wantCoverage: 72.4,
+		},
+		{
+			name:       "project without coverage",
+			handler:    serveJSON(t, http.StatusOK, map[string]interface{}{"component": map[string]interface{}{}}),
+			wantStatus: StatusNoUploads,
+		},
+		{
+			name:       "unknown project",
+			handler:    serveJSON(t, http.StatusNotFound, nil),
+			wantStatus: StatusNotConfigured,
+		},
+		{
+			name:       "bad token",
+			handler:    serveJSON(t, http.StatusUnauthorized, nil),
+			wantStatus: StatusAuthError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _, _ := r.BasicAuth()
+				query := r.URL.Query()
+				if r.URL.Path != "/api/measures/component" || user != "secret" || query.Get("component") != "myorg_myrepo" || query.Get("branch") != "main" {
+					t.Errorf("unexpected request %s as %q", r.URL, user)
+				}
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			p := &sonarqubeProvider{host: server.URL, token: "secret"}
+			got := p.RepoCoverage("myorg", "myrepo", "main", "")
+			if got.Status != tt.wantStatus || got.Coverage != tt.wantCoverage {
+				t.Errorf("RepoCoverage() = %v %.2f, want %v %.2f (err %v)", got.Status, got.Coverage, tt.wantStatus, tt.wantCoverage, got.Err)
+			}
+		})
+	}
+}
+
+func TestSonarqubeProviderDetailedReport(t *testing.T) {
+	component := serveJSON(t, http.StatusOK, map[string]interface{}{
+		"component": map[string]interface{}{"measures": []sonarMeasure{{Metric: "coverage", Value: "50"}}},
+	})
+	tree := func(w http.ResponseWriter, r *http.Request) {
+		file := map[string]interface{}{
+			"path": "a.go",
+			"measures": []sonarMeasure{
+				{Metric: "coverage", Value: "50"},
+				{Metric: "lines_to_cover", Value: "10"},
+				{Metric: "uncovered_lines", Value: "5"},
+			},
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("p"))
+		if page == 2 {
+			file["path"] = "b.go"
+		}
+		serveJSON(t, http.StatusOK, map[string]interface{}{
+			"paging":     map[string]int{"pageIndex": page, "pageSize": 1, "total": 2},
+			"components": []interface{}{file},
+		})(w, r)
+	}
+
+	t.Run("paged files", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/measures/component", component)
+		mux.HandleFunc("/api/measures/component_tree", func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("p")
+			if page != "1" && page != "2" {
+				t.Errorf("unexpected page %q", page)
+			}
+			tree(w, r)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		p := &sonarqubeProvider{host: server.URL, token: "secret"}
+		report, err := p.DetailedReport("myorg", "myrepo", "main", "")
+		if err != nil {
+			t.Fatalf("DetailedReport: %v", err)
+		}
+		if report.Totals.Coverage != 50 || len(report.Files) != 2 {
+			t.Fatalf("DetailedReport() = %+v, want 2 files at 50%%", report)
+		}
+		if f := report.Files[1]; f.Name != "b.go" || f.Totals.Lines != 10 || f.Totals.Misses != 5 || f.Totals.Hits != 5 {
+			t.Errorf("second file = %+v", f)
+		}
+	})
+
+	t.Run("project error", func(t *testing.T) {
+		server := httptest.NewServer(serveJSON(t, http.StatusForbidden, nil))
+		defer server.Close()
+
+		p := &sonarqubeProvider{host: server.URL, token: "secret"}
+		if _, err := p.DetailedReport("myorg", "myrepo", "main", ""); statusForError(err) != StatusAuthError {
+			t.Errorf("DetailedReport() error = %v, want an auth error", err)
+		}
+	})
+}
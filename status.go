@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// CoverageStatus describes the outcome of fetching coverage for a repo
+type CoverageStatus int
+
+const (
+	// StatusCovered means the repo has a non-zero coverage number
+	StatusCovered CoverageStatus = iota
+	// StatusNotConfigured means the provider does not know the repo
+	StatusNotConfigured
+	// StatusNoUploads means the repo is set up with the provider but has no coverage reports
+	StatusNoUploads
+	// StatusAuthError means the provider rejected our credentials
+	StatusAuthError
+	// StatusTransientError means the provider could not be reached or failed after retries
+	StatusTransientError
+	// StatusZeroCoverage means the latest report has 0% coverage
+	StatusZeroCoverage
+)
+
+func (s CoverageStatus) String() string {
+	switch s {
+	case StatusCovered:
+		return "Covered"
+	case StatusNotConfigured:
+		return "Not Configured"
+	case StatusNoUploads:
+		return "No Uploads"
+	case StatusAuthError:
+		return "Auth Error"
+	case StatusTransientError:
+		return "Transient Error"
+	case StatusZeroCoverage:
+		return "Zero Coverage"
+	}
+	return fmt.Sprintf("CoverageStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status by name, so stored snapshots stay readable
+func (s CoverageStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status name written by MarshalText
+func (s *CoverageStatus) UnmarshalText(text []byte) error {
+	for status := StatusCovered; status <= StatusZeroCoverage; status++ {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown coverage status %q", text)
+}
+
+// HasCoverage reports whether the status comes with a coverage percentage
+func (s CoverageStatus) HasCoverage() bool {
+	return s == StatusCovered || s == StatusZeroCoverage
+}
+
+// IsError reports whether the status means coverage could not be determined
+func (s CoverageStatus) IsError() bool {
+	return s == StatusAuthError || s == StatusTransientError
+}
+
+// Exit codes for the coverage tool; log.Fatal exits with 1
+const (
+	exitOK          = 0
+	exitAPIErrors   = 2 // coverage could not be fetched for some repos
+	exitRegressions = 3 // coverage dropped by more than the allowed threshold
+	exitViolations  = 4 // coverage is below the policy minimum
+)
+
+// APIError is returned when a coverage API answers with a non-200 status
+type APIError struct {
+	Service    string
+	StatusCode int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API returned non-200 status: %d", e.Service, e.StatusCode)
+}
+
+// statusForError maps an error from a coverage API call to a status
+func statusForError(err error) CoverageStatus {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// network errors, timeouts and malformed responses
+		return StatusTransientError
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return StatusAuthError
+	case http.StatusNotFound:
+		return StatusNotConfigured
+	}
+	return StatusTransientError
+}
+
+// coverageResult builds the RepoCoverage for a repo from a coverage percentage
+func coverageResult(repo string, coverage float64) RepoCoverage {
+	if coverage == 0 {
+		return RepoCoverage{Name: repo, Status: StatusZeroCoverage}
+	}
+	return RepoCoverage{Name: repo, Coverage: coverage, Status: StatusCovered}
+}
+
+// errorResult builds the RepoCoverage for a repo whose coverage could not be fetched
+func errorResult(repo string, err error) RepoCoverage {
+	return RepoCoverage{Name: repo, Status: statusForError(err), Err: err}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want CoverageStatus
+	}{
+		{"unauthorized", &APIError{Service: "codecov", StatusCode: http.StatusUnauthorized}, StatusAuthError},
+		{"forbidden", &APIError{Service: "codecov", StatusCode: http.StatusForbidden}, StatusAuthError},
+		{"not found", &APIError{Service: "coveralls", StatusCode: http.StatusNotFound}, StatusNotConfigured},
+		{"wrapped not found", fmt.Errorf("fetching report: %w", &APIError{StatusCode: http.StatusNotFound}), StatusNotConfigured},
+		{"server error", &APIError{Service: "sonarqube", StatusCode: http.StatusBadGateway}, StatusTransientError},
+		{"rate limited", &APIError{Service: "codecov", StatusCode: http.StatusTooManyRequests}, StatusTransientError},
+		{"network error", errors.New("connection reset by peer"), StatusTransientError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusForError(tt.err); got != tt.want {
+				t.Errorf("statusForError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoverageStatusText(t *testing.T) {
+	for status := StatusCovered; status <= StatusZeroCoverage; status++ {
+		text, err := status.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%d): %v", status, err)
+		}
+		var got CoverageStatus
+		if err := got.UnmarshalText(text); err != nil || got != status {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, got, err, status)
+		}
+	}
+
+	var status CoverageStatus
+	if err := status.UnmarshalText([]byte("Bogus")); err == nil {
+		t.Errorf("UnmarshalText(Bogus) succeeded, want an error")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"gopkg.in/yaml.v3"
+)
+
+// Organization scanned when neither flags nor the config file name one
+const defaultOrg = "openshift"
+
+// repoTarget is a repository to fetch coverage for
+type repoTarget struct {
+	Org    string
+	Name   string
+	Branch string             // branch to query coverage for
+	Repo   *github.Repository // metadata from GitHub
+}
+
+// FullName returns the "org/repo" name of the target
+func (t repoTarget) FullName() string {
+	return t.Org + "/" + t.Name
+}
+
+// Config is the optional YAML config file. Example:
+//
+//	orgs: [openshift, openshift-eng]
+//	branch: ""            # override the default branch of every repo
+//	repos:                # scan only these repos instead of whole orgs
+//	  - openshift/cloud-ingress-operator
+//	  - openshift/must-gather@release-4.14
+type Config struct {
+	Orgs   []string `yaml:"orgs"`
+	Branch string   `yaml:"branch"`
+	Repos  []string `yaml:"repos"`
+}
+
+// targetOptions are the flags selecting which repos to scan
+type targetOptions struct {
+	configFile string
+	orgs       string
+	reposFile  string
+	branch     string
+	filter     *repoFilter
+
+	repoList []string // entries read from reposFile
+}
+
+// addTargetFlags registers the repo selection flags on fs
+func addTargetFlags(fs *flag.FlagSet) *targetOptions {
+	opts := &targetOptions{}
+	fs.StringVar(&opts.configFile, "config", "", "YAML config file listing orgs, repos and branch")
+	fs.StringVar(&opts.orgs, "org", "", "Comma-separated GitHub organizations to scan (default \""+defaultOrg+"\")")
+	fs.StringVar(&opts.reposFile, "repos-file", "", "File with one org/repo[@branch] per line to scan instead of whole orgs (- for stdin)")
+	fs.StringVar(&opts.branch, "branch", "", "Branch to query for every repo (default: each repo's default branch)")
+	opts.filter = addFilterFlags(fs)
+	return opts
+}
+
+// resolve returns the repos to scan. Flags take precedence over the config file.
+// Filters only apply to repos listed from orgs, not to explicit repo lists.
+func (o *targetOptions) resolve(ctx context.Context, ghClient *github.Client) ([]repoTarget, error) {
+	if err := o.filter.compile(); err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if o.configFile != "" {
+		data, err := os.ReadFile(o.configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("error parsing config %s: %v", o.configFile, err)
+		}
+	}
+
+	orgs := config.Orgs
+	if o.orgs != "" {
+		orgs = splitList(o.orgs)
+	}
+	if len(orgs) == 0 {
+		orgs = []string{defaultOrg}
+	}
+
+	branch := config.Branch
+	if o.branch != "" {
+		branch = o.branch
+	}
+
+	entries := config.Repos
+	if o.reposFile != "" {
+		// stdin can only be read once, so keep the list for later calls
+		if o.repoList == nil {
+			list, err := readRepoList(o.reposFile)
+			if err != nil {
+				return nil, err
+			}
+			o.repoList = list
+		}
+		entries = o.repoList
+	}
+
+	// an explicit repo list replaces scanning whole orgs
+	if len(entries) > 0 {
+		return explicitTargets(ctx, ghClient, entries, orgs[0], branch)
+	}
+
+	now := time.Now()
+	var targets []repoTarget
+	for _, org := range orgs {
+		repos, err := getAllRepos(ctx, ghClient, org)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			if o.filter.match(repo, now) {
+				targets = append(targets, newRepoTarget(org, repo, branch))
+			}
+		}
+	}
+	return targets, nil
+}
+
+// getAllRepos lists every repository of org, one page at a time
+func getAllRepos(ctx context.Context, ghClient *github.Client, org string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		var repos []*github.Repository
+		var resp *github.Response
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var err error
+			repos, resp, err = ghClient.Repositories.ListByOrg(ctx, org, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching repositories from GitHub: %v", err)
+		}
+
+		allRepos = append(allRepos, repos...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
+	}
+
+	return allRepos, nil
+}
+
+// newRepoTarget builds a target, querying branch if set and the repo's default branch otherwise
+func newRepoTarget(org string, repo *github.Repository, branch string) repoTarget {
+	if branch == "" {
+		branch = repo.GetDefaultBranch()
+	}
+	return repoTarget{Org: org, Name: repo.GetName(), Branch: branch, Repo: repo}
+}
+
+// explicitTargets looks up each "org/repo[@branch]" entry on GitHub; entries without
+// an org belong to fallbackOrg
+func explicitTargets(ctx context.Context, ghClient *github.Client, entries []string, fallbackOrg, branch string) ([]repoTarget, error) {
+	var targets []repoTarget
+	for _, entry := range entries {
+		name, repoBranch, _ := strings.Cut(entry, "@")
+		org, repoName, ok := strings.Cut(name, "/")
+		if !ok {
+			org, repoName = fallbackOrg, name
+		}
+		if repoBranch == "" {
+			repoBranch = branch
+		}
+
+		var repo *github.Repository
+		err := withGitHubRetry(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			repo, resp, err = ghClient.Repositories.Get(ctx, org, repoName)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching repository %s/%s from GitHub: %v", org, repoName, err)
+		}
+
+		targets = append(targets, newRepoTarget(org, repo, repoBranch))
+	}
+	return targets, nil
+}
+
+// readRepoList reads repo entries, one per line, skipping blank lines and # comments
+func readRepoList(filename string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, scanner.Err()
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// orgNames returns the distinct orgs of targets, in order of first appearance
+func orgNames(targets []repoTarget) []string {
+	seen := map[string]bool{}
+	var orgs []string
+	for _, target := range targets {
+		if !seen[target.Org] {
+			seen[target.Org] = true
+			orgs = append(orgs, target.Org)
+		}
+	}
+	return orgs
+}
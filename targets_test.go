@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+)
+
+// newTestGitHubClient returns a GitHub client talking to a fake API served by handler
+func newTestGitHubClient(t *testing.T, handler http.Handler) *github.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+// fakeRepoAPI serves every org as having one repo named <org>-repo, and any repo
+// looked up by name, all on default branch main
+func fakeRepoAPI() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/", func(w http.ResponseWriter, r *http.Request) {
+		org := strings.Split(strings.TrimPrefix(r.URL.Path, "/orgs/"), "/")[0]
+		json.NewEncoder(w).Encode([]map[string]string{{"name": org + "-repo", "default_branch": "main"}})
+	})
+	mux.HandleFunc("/repos/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+		json.NewEncoder(w).Encode(map[string]string{"name": parts[1], "default_branch": "main"})
+	})
+	return mux
+}
+
+// targetNames returns the targets as org/repo@branch
+func targetNames(targets []repoTarget) []string {
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.FullName()+"@"+target.Branch)
+	}
+	return names
+}
+
+// writeTestFile writes content to name in a temporary directory and returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTargetOptionsResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		orgs      string
+		reposFile string
+		branch    string
+		want      []string
+	}{
+		{
+			name: "default org",
+			want: []string{"openshift/openshift-repo@main"},
+		},
+		{
+			name:   "config orgs and branch",
+			config: "orgs: [acme, widgets]\nbranch: develop\n",
+			want:   []string{"acme/acme-repo@develop", "widgets/widgets-repo@develop"},
+		},
+		{
+			name:   "flags override config",
+			config: "orgs: [acme]\nbranch: develop\n",
+			orgs:   "other",
+			branch: "release",
+			want:   []string{"other/other-repo@release"},
+		},
+		{
+			name:   "config repos replace org scans",
+			config: "orgs: [acme]\nrepos:\n  - widgets/api\n  - cli@v2\n",
+			want:   []string{"widgets/api@main", "acme/cli@v2"},
+		},
+		{
+			name:   "bare names use the first -org",
+			config: "orgs: [acme]\nrepos: [cli]\n",
+			orgs:   "other,acme",
+			branch: "release",
+			want:   []string{"other/cli@release"},
+		},
+		{
+			name:      "repos file overrides config repos",
+			config:    "repos: [acme/cli]\n",
+			reposFile: "# repos to scan\nwidgets/api\n\n  tools@dev  \n",
+			want:      []string{"widgets/api@main", "openshift/tools@dev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &targetOptions{orgs: tt.orgs, branch: tt.branch, filter: &repoFilter{}}
+			if tt.config != "" {
+				opts.configFile = writeTestFile(t, "config.yaml", tt.config)
+			}
+			if tt.reposFile != "" {
+				opts.reposFile = writeTestFile(t, "repos.txt", tt.reposFile)
+			}
+
+			targets, err := opts.resolve(context.Background(), newTestGitHubClient(t, fakeRepoAPI()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := targetNames(targets); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetOptionsResolveStdin(t *testing.T) {
+	stdin := writeTestFile(t, "stdin", "acme/api\ncli\n")
+	file, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	oldStdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	opts := &targetOptions{orgs: "widgets", reposFile: "-", filter: &repoFilter{}}
+	client := newTestGitHubClient(t, fakeRepoAPI())
+	want := []string{"acme/api@main", "widgets/cli@main"}
+	// stdin is consumed by the first call, later calls must reuse the list
+	for i := 0; i < 2; i++ {
+		targets, err := opts.resolve(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := targetNames(targets); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolve() call %d = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestTargetOptionsResolveErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *targetOptions
+	}{
+		{"missing config", &targetOptions{configFile: filepath.Join(t.TempDir(), "missing.yaml"), filter: &repoFilter{}}},
+		{"invalid config", &targetOptions{configFile: writeTestFile(t, "config.yaml", "orgs: {"), filter: &repoFilter{}}},
+		{"missing repos file", &targetOptions{reposFile: filepath.Join(t.TempDir(), "missing.txt"), filter: &repoFilter{}}},
+		{"invalid filter", &targetOptions{filter: &repoFilter{includeName: "("}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.resolve(context.Background(), newTestGitHubClient(t, fakeRepoAPI())); err == nil {
+				t.Error("resolve() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestExplicitTargetsNotFound(t *testing.T) {
+	client := newTestGitHubClient(t, http.NotFoundHandler())
+	if _, err := explicitTargets(context.Background(), client, []string{"acme/missing"}, "acme", ""); err == nil {
+		t.Error("explicitTargets() succeeded for a missing repo, want error")
+	}
+}
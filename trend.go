@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default directory for coverage snapshots, relative to the working directory
+const defaultHistoryDir = "coverage-history"
+
+// repoTrend is the coverage of one repo across a range of snapshots
+type repoTrend struct {
+	Name     string
+	Baseline *SnapshotRecord
+	Latest   *SnapshotRecord
+	History  []*SnapshotRecord // one entry per snapshot, nil where the repo was missing
+}
+
+// Delta returns the change in coverage points, and false if either end has no coverage number
+func (t *repoTrend) Delta() (float64, bool) {
+	if t.Baseline == nil || t.Latest == nil || !t.Baseline.Status.HasCoverage() || !t.Latest.Status.HasCoverage() {
+		return 0, false
+	}
+	return t.Latest.RawCoverage() - t.Baseline.RawCoverage(), true
+}
+
+// runTrend implements the "trend" command, printing per-repo deltas between a baseline
+// snapshot and the latest one. It returns the process exit code.
+func runTrend(args []string) int {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	historyDir := fs.String("history-dir", defaultHistoryDir, "Directory holding coverage snapshots")
+	threshold := fs.Float64("threshold", 1, "Flag repos whose coverage dropped by more than this many points")
+	baselineFlag := fs.String("baseline", "", "Compare against the last snapshot taken at or before this date (YYYY-MM-DD in local time, or RFC 3339) instead of the previous snapshot")
+	logOpts := addLogFlags(fs)
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	snapshots, err := loadSnapshots(*historyDir)
+	if err != nil {
+		log.Fatalf("❌ Error reading snapshots: %v", err)
+	}
+	if len(snapshots) < 2 && *baselineFlag == "" {
+		fmt.Printf("Need at least two snapshots in %s to show a trend, found %d\n", *historyDir, len(snapshots))
+		return exitOK
+	}
+
+	// by default compare against the snapshot before the latest one
+	baselineIdx := len(snapshots) - 2
+	if *baselineFlag != "" {
+		before, err := parseBaselineTime(*baselineFlag)
+		if err != nil {
+			log.Fatalf("❌ Invalid baseline: %v", err)
+		}
+		baselineIdx = lastSnapshotBefore(snapshots, before)
+		if baselineIdx < 0 {
+			log.Fatalf("❌ No snapshot taken at or before %s", *baselineFlag)
+		}
+	}
+
+	trends := buildTrends(snapshots[baselineIdx:])
+	baseline := snapshots[baselineIdx].Time
+	latest := snapshots[len(snapshots)-1].Time
+
+	fmt.Printf("Raw coverage trend from %s to %s\n", baseline.Format(time.RFC3339), latest.Format(time.RFC3339))
+	fmt.Println("Repository, Baseline, Latest, Delta, History")
+
+	regressions := 0
+	for _, trend := range trends {
+		line := fmt.Sprintf("%s, %s, %s, %s, %s", trend.Name, formatRecord(trend.Baseline), formatRecord(trend.Latest), formatDelta(trend), formatHistory(trend.History))
+		if delta, ok := trend.Delta(); ok && -delta > *threshold {
+			line += " ⚠️ regression"
+			regressions++
+		}
+		fmt.Println(line)
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\n❌ %d repositories lost more than %.2f points since %s\n", regressions, *threshold, baseline.Format(time.RFC3339))
+		return exitRegressions
+	}
+	return exitOK
+}
+
+// buildTrends lines up each repo's records across snapshots, sorted by repo name
+func buildTrends(snapshots []Snapshot) []*repoTrend {
+	byName := map[string]*repoTrend{}
+	for i, snapshot := range snapshots {
+		for j := range snapshot.Records {
+			record := &snapshot.Records[j]
+			name := record.Org + "/" + record.Repo
+			trend, ok := byName[name]
+			if !ok {
+				trend = &repoTrend{Name: name, History: make([]*SnapshotRecord, len(snapshots))}
+				byName[name] = trend
+			}
+			trend.History[i] = record
+			if i == 0 {
+				trend.Baseline = record
+			}
+			if i == len(snapshots)-1 {
+				trend.Latest = record
+			}
+		}
+	}
+
+	trends := make([]*repoTrend, 0, len(byName))
+	for _, trend := range byName {
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		return trends[i].Name < trends[j].Name
+	})
+	return trends
+}
+
+// parseBaselineTime accepts a date or a full RFC 3339 timestamp and returns the time
+// baseline snapshots must be taken before. A bare date is a day in local time, like
+// snapshot times, and includes the whole day.
+func parseBaselineTime(value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		// snapshot times have nanosecond precision, so this includes at itself
+		return at.Add(time.Nanosecond), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// lastSnapshotBefore returns the index of the last of the time-ordered snapshots taken
+// before the given time, or -1 if there is none
+func lastSnapshotBefore(snapshots []Snapshot, before time.Time) int {
+	idx := -1
+	for i, snapshot := range snapshots {
+		if snapshot.Time.Before(before) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func formatRecord(record *SnapshotRecord) string {
+	if record == nil {
+		return "-"
+	}
+	if record.Status.HasCoverage() {
+		return fmt.Sprintf("%.2f%%", record.RawCoverage())
+	}
+	return record.Status.String()
+}
+
+func formatDelta(trend *repoTrend) string {
+	delta, ok := trend.Delta()
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f", delta)
+}
+
+func formatHistory(history []*SnapshotRecord) string {
+	values := make([]string, len(history))
+	for i, record := range history {
+		if record != nil && record.Status.HasCoverage() {
+			values[i] = fmt.Sprintf("%.2f", record.RawCoverage())
+		} else {
+			values[i] = "-"
+		}
+	}
+	return strings.Join(values, " ")
+}